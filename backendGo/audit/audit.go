@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backendGo/models"
+	"backendGo/utils"
+)
+
+// Event types recorded in the audit log
+const (
+	LoginSucceeded       = "login.success"
+	LoginFailed          = "login.failure"
+	TwoFactorPassed      = "2fa.success"
+	TwoFactorFailed      = "2fa.failure"
+	AccountRegistered    = "account.registered"
+	RegistrationRejected = "account.registration_rejected"
+	AccountLocked        = "account.locked"
+	EmailVerified        = "email.verified"
+	EmailChangeRequested = "email.change_requested"
+	EmailChanged         = "email.changed"
+	PasswordChanged      = "password.changed"
+	PasswordReset        = "password.reset"
+	SessionLoggedOut     = "session.logout"
+	SessionRevoked       = "session.revoked"
+	SessionsRevokedAll   = "session.revoked_all"
+	RoleChanged          = "account.role_changed"
+	NewDeviceLogin       = "login.new_device"
+	CompromiseReported   = "account.compromise_reported"
+	DeviceTrusted        = "device.trusted"
+	DeviceTrustRevoked   = "device.trust_revoked"
+	MagicLinkRequested   = "login.magic_link_requested"
+	MagicLinkToggled     = "account.magic_link_toggled"
+)
+
+// Event describes something to append to the audit log
+type Event struct {
+	Type    string
+	AccID   uint64                 // Account the event is about; 0 when unknown
+	ActorID uint64                 // Account that caused it when different from AccID, such as an admin; 0 otherwise
+	Details map[string]interface{} // Extra context; must never contain codes, tokens, passwords or secrets
+}
+
+// Filter narrows an audit log query; zero values match everything
+type Filter struct {
+	AccID     uint64
+	EventType string
+	From, To  time.Time
+	Page      int
+	Limit     int
+}
+
+// Null for unknown account IDs
+func nullableID(id uint64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// Append an event with the client IP and user agent of the request; failures are logged, never returned
+func Record(db *sql.DB, r *http.Request, event Event) {
+	var ipAddress, userAgent interface{}
+	if r != nil {
+		ipAddress, userAgent = utils.ClientIP(r), r.UserAgent()
+	}
+
+	var details interface{}
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err != nil {
+			log.Printf("Error encoding audit details for %s: %v", event.Type, err)
+		} else {
+			details = string(encoded)
+		}
+	}
+
+	_, err := db.Exec("INSERT INTO audit_events (event_type, acc_id, actor_id, ip_address, user_agent, details) VALUES ($1, $2, $3, $4, $5, $6)",
+		event.Type, nullableID(event.AccID), nullableID(event.ActorID), ipAddress, userAgent, details)
+	if err != nil {
+		log.Printf("Error recording audit event %s: %v", event.Type, err)
+	}
+}
+
+// Query the audit log, newest first, returning one page of events and the total number of matches
+func Query(db *sql.DB, filter Filter) ([]models.AuditEvent, int, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.AccID != 0 {
+		addCondition("(acc_id = $%[1]d OR actor_id = $%[1]d)", filter.AccID)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if !filter.From.IsZero() {
+		addCondition("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("created_at < $%d", filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_events"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, (filter.Page-1)*filter.Limit)
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, event_type, acc_id, actor_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), details, created_at
+		FROM audit_events%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var accID, actorID sql.NullInt64
+		var details []byte
+		if err := rows.Scan(&event.ID, &event.EventType, &accID, &actorID, &event.IPAddress, &event.UserAgent, &details, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if accID.Valid {
+			id := uint64(accID.Int64)
+			event.AccID = &id
+		}
+		if actorID.Valid {
+			id := uint64(actorID.Int64)
+			event.ActorID = &id
+		}
+		if details != nil {
+			event.Details = json.RawMessage(details)
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backendGo/audit"
+	"backendGo/config"
+	"backendGo/lockout"
+	"backendGo/models"
+	"backendGo/session"
+	"backendGo/utils"
+	"backendGo/validation"
+
+	"github.com/google/uuid"
+)
+
+// Change Password Handler (requires the current password, signs out other devices)
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	current, ok := session.FromContext(r.Context())
+	account, _ := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var passwordDetails struct {
+		CurrentPassword string `json:"CurrentPassword"`
+		NewPassword     string `json:"NewPassword"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&passwordDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	var errs validation.Errors
+	validation.Password("NewPassword", passwordDetails.NewPassword, account.UserName, account.Email, &errs)
+	if len(errs) > 0 {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, errs.Body())
+		return
+	}
+
+	if !confirmCurrentPassword(w, r, db, mail, account, passwordDetails.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := HashPassword(r.Context(), passwordDetails.NewPassword)
+	if err != nil {
+		writeHashingError(w, err)
+		return
+	}
+
+	_, err = db.Exec("UPDATE accounts SET encrypted_password = $1 WHERE acc_id = $2", hashedPassword, account.AccID)
+	if err != nil {
+		log.Printf("Error updating password for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error changing password"})
+		return
+	}
+
+	audit.Record(db, r, audit.Event{Type: audit.PasswordChanged, AccID: account.AccID})
+
+	// Keep this device signed in but end every other session
+	if _, err := session.RevokeOthers(db, account.AccID, current.SessionID); err != nil {
+		log.Printf("Error revoking other sessions for account %d: %v", account.AccID, err)
+	}
+
+	if err := mail.sendPasswordChangedNotice(account.Email); err != nil {
+		log.Printf("Error sending password change notice for account %d: %v", account.AccID, err)
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Password changed. Other devices have been signed out."})
+}
+
+// Change Email Handler (sends a confirmation link to the new address and notifies the old one)
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var emailDetails struct {
+		NewEmail        string `json:"NewEmail"`
+		CurrentPassword string `json:"CurrentPassword"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&emailDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	emailDetails.NewEmail = validation.Normalize(emailDetails.NewEmail)
+	var errs validation.Errors
+	validation.Email("NewEmail", emailDetails.NewEmail, &errs)
+	if len(errs) > 0 {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, errs.Body())
+		return
+	}
+	if validation.Key(emailDetails.NewEmail) == validation.Key(account.Email) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "A different email address is required"})
+		return
+	}
+
+	if !confirmCurrentPassword(w, r, db, mail, account, emailDetails.CurrentPassword) {
+		return
+	}
+
+	// Only the latest pending email change can be confirmed
+	_, err = db.Exec("DELETE FROM email_verifications WHERE acc_id = $1 AND new_email IS NOT NULL", account.AccID)
+	if err != nil {
+		log.Printf("Error clearing pending email changes for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error changing email"})
+		return
+	}
+
+	verificationToken := uuid.New().String()
+	_, err = db.Exec("INSERT INTO email_verifications (acc_id, verification_token, new_email) VALUES ($1, $2, $3)", account.AccID, verificationToken, emailDetails.NewEmail)
+	if err != nil {
+		log.Printf("Error storing email change for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error changing email"})
+		return
+	}
+
+	verificationLink := fmt.Sprintf("%s/verify-email?token=%s", config.APIBaseURL, verificationToken)
+	if err := mail.sendVerificationEmail(emailDetails.NewEmail, verificationLink); err != nil {
+		log.Printf("Error sending email change verification for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending verification email"})
+		return
+	}
+
+	audit.Record(db, r, audit.Event{Type: audit.EmailChangeRequested, AccID: account.AccID})
+
+	if err := mail.sendEmailChangeNotice(account.Email, emailDetails.NewEmail); err != nil {
+		log.Printf("Error notifying old address for account %d: %v", account.AccID, err)
+	}
+
+	utils.WriteJSONResponse(w, http.StatusAccepted, map[string]string{"message": "Check your new email address to confirm the change."})
+}
+
+// Re-check the signed-in user's password before a sensitive change, writing the error response and returning false when it does not match
+// Wrong guesses count towards the same backoff and lockout as failed logins, so a session cannot be used to brute-force the password
+func confirmCurrentPassword(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail, account models.Account, password string) bool {
+	accountKey := lockout.AccountKey(account.UserName)
+	if rejectIfBlocked(w, db, utils.ClientIP(r), accountKey) {
+		return false
+	}
+
+	var encryptedPassword string
+	err := db.QueryRow("SELECT encrypted_password FROM accounts WHERE acc_id = $1", account.AccID).Scan(&encryptedPassword)
+	if err != nil {
+		log.Printf("Error fetching account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error checking password"})
+		return false
+	}
+
+	passwordOK, err := CheckPassword(r.Context(), encryptedPassword, password)
+	if err != nil {
+		writeHashingError(w, err)
+		return false
+	}
+	if !passwordOK {
+		recordAuthFailure(r, db, mail, accountKey, &account)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
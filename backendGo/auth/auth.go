@@ -1,62 +1,97 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/smtp"
-	"os"
+	"strconv"
 	"time"
 
+	"backendGo/audit"
+	"backendGo/cache"
+	"backendGo/challenge"
+	"backendGo/config"
+	"backendGo/device"
+	"backendGo/lockout"
+	"backendGo/mailer"
 	"backendGo/models"
+	"backendGo/onetimecode"
+	"backendGo/passhash"
+	"backendGo/recoverycode"
 	"backendGo/scores"
+	"backendGo/secrets"
 	"backendGo/session"
 	"backendGo/utils"
+	"backendGo/validation"
 
 	"database/sql"
 
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
+	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// Load the environment variables
-func loadEnvVariables() error {
-	err := godotenv.Load("./.env")
-	if err != nil {
-		return fmt.Errorf("error loading .env file: %v", err)
+// Hash password on the shared hashing pool
+func HashPassword(ctx context.Context, password string) (string, error) {
+	return passhash.Workers.Hash(ctx, password)
+}
+
+// Compare passwords on the shared hashing pool; only pool errors are returned, unreadable hashes simply fail to match
+func CheckPassword(ctx context.Context, hashedPassword, password string) (bool, error) {
+	ok, err := passhash.Workers.Verify(ctx, hashedPassword, password)
+	if errors.Is(err, passhash.ErrUnknownFormat) || errors.Is(err, passhash.ErrMalformedHash) {
+		log.Printf("Error verifying password hash: %v", err)
+		return false, nil
 	}
-	fmt.Println("Environment variables loaded successfully.")
-	fmt.Println("SMTP_FROM:", os.Getenv("SMTP_FROM"))
-	fmt.Println("SMTP_PASSWORD:", os.Getenv("SMTP_PASSWORD"))
-	fmt.Println("SMTP_SERVER:", os.Getenv("SMTP_SERVER"))
-	fmt.Println("SMTP_PORT:", os.Getenv("SMTP_PORT"))
+	return ok, err
+}
 
-	return nil
+// Respond to a password hashing failure, asking the client to retry when the pool is saturated
+func writeHashingError(w http.ResponseWriter, err error) {
+	if errors.Is(err, passhash.ErrBusy) || errors.Is(err, context.DeadlineExceeded) {
+		w.Header().Set("Retry-After", "1")
+		utils.WriteJSONResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "Server is busy. Please try again shortly."})
+		return
+	}
+	if !errors.Is(err, context.Canceled) {
+		log.Printf("Error hashing password: %v", err)
+	}
+	utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error hashing password"})
 }
 
-// Hash password
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// Replace a stored hash made with an outdated algorithm or parameters, now that the plaintext is known
+func upgradePasswordHash(ctx context.Context, db *sql.DB, account models.Account, password string) {
+	if !passhash.NeedsRehash(account.EncryptedPassword) {
+		return
+	}
+
+	hashedPassword, err := HashPassword(ctx, password)
+	if err != nil {
+		log.Printf("Error rehashing password for account %d: %v", account.AccID, err)
+		return
+	}
+
+	// Only replace the hash that was verified, in case the password changed meanwhile
+	_, err = db.Exec("UPDATE accounts SET encrypted_password = $1 WHERE acc_id = $2 AND encrypted_password = $3", hashedPassword, account.AccID, account.EncryptedPassword)
 	if err != nil {
-		return "", err
+		log.Printf("Error storing rehashed password for account %d: %v", account.AccID, err)
 	}
-	return string(hashedPassword), nil
 }
 
-// Compare passwords
-func CheckPassword(hashedPassword, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+// Respond to a failed login without revealing whether the account exists, the password was wrong or the email is unverified
+func writeInvalidCredentials(w http.ResponseWriter) {
+	utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Invalid username or password. If you just registered, check your email for the verification link."})
 }
 
-// Generate 2FA key for the account
-func Generate2FASecret() (string, string, error) {
+// Generate 2FA key for the account, returning the secret and its otpauth URI
+func Generate2FASecret(accountName string) (string, string, error) {
 	key, err := totp.Generate(totp.GenerateOpts{
-		Issuer:      "MyApp",            // Change to your app name
-		AccountName: "user@example.com", // Replace with user email
+		Issuer:      config.TOTPIssuer,
+		AccountName: accountName,
+		Period:      config.TOTPPeriod,
 	})
 	if err != nil {
 		return "", "", err
@@ -64,13 +99,33 @@ func Generate2FASecret() (string, string, error) {
 	return key.Secret(), key.URL(), nil
 }
 
-// Verify 2FA code
-func Verify2FACode(secret, code string) bool {
-	return totp.Validate(code, secret)
+// Find the time step an authenticator code belongs to, allowing for clock drift, so each step can be accepted only once
+func totpStep(secret, code string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{Period: config.TOTPPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for offset := -config.TOTPSkew; offset <= config.TOTPSkew; offset++ {
+		at := now.Add(time.Duration(offset*config.TOTPPeriod) * time.Second)
+		if ok, err := totp.ValidateCustom(code, secret, at, opts); err == nil && ok {
+			return at.Unix() / config.TOTPPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// Record an authenticator code's time step as used, reporting false when that step or a later one was already accepted
+func acceptTOTPStep(db *sql.DB, accountID uint64, step int64) (bool, error) {
+	result, err := db.Exec("UPDATE accounts SET totp_last_step = $1 WHERE acc_id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)", step, accountID)
+	if err != nil {
+		return false, err
+	}
+	accepted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return accepted > 0, nil
 }
 
 // Login Handler (Step 1: Check username and password)
-func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
 	// Extract login details
 	var loginDetails struct {
 		Username string `json:"Username"`
@@ -82,53 +137,120 @@ func LoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
+	// Refuse early while the client or account is backing off or locked out
+	clientIP := utils.ClientIP(r)
+	accountKey := lockout.AccountKey(loginDetails.Username)
+	if rejectIfBlocked(w, db, clientIP, accountKey) {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, Details: map[string]interface{}{"username": loginDetails.Username, "reason": "blocked"}})
+		return
+	}
+
 	// Query the account by username
 	var account models.Account
-	err = db.QueryRow("SELECT acc_id, username, email, encrypted_password, secretkey_2fa, is_email_verified FROM accounts WHERE username = $1", loginDetails.Username).Scan(
-		&account.AccID, &account.UserName, &account.Email, &account.EncryptedPassword, &account.SecretKey2FA, &account.IsEmailVerified,
+	var mustResetPassword bool
+	err = db.QueryRow("SELECT acc_id, username, email, encrypted_password, secretkey_2fa, is_email_verified, two_factor_method, must_reset_password FROM accounts WHERE username_key = $1", accountKey).Scan(
+		&account.AccID, &account.UserName, &account.Email, &account.EncryptedPassword, &account.SecretKey2FA, &account.IsEmailVerified, &account.TwoFactorMethod, &mustResetPassword,
 	)
 	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching account for login: %v", err)
+		}
+		// Spend the same hashing time as a real check so unknown usernames do not answer faster
+		if _, err := CheckPassword(r.Context(), passhash.DummyHash(), loginDetails.Password); err != nil {
+			writeHashingError(w, err)
+			return
+		}
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, Details: map[string]interface{}{"username": loginDetails.Username, "reason": "unknown_user"}})
+		recordAuthFailure(r, db, mail, accountKey, nil)
+		writeInvalidCredentials(w)
 		return
 	}
 
-	// Check if email is verified
+	// Check password before anything else about the account so every failure costs the same
+	passwordOK, err := CheckPassword(r.Context(), account.EncryptedPassword, loginDetails.Password)
+	if err != nil {
+		writeHashingError(w, err)
+		return
+	}
+	if !passwordOK {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, AccID: account.AccID, Details: map[string]interface{}{"reason": "invalid_password"}})
+		recordAuthFailure(r, db, mail, accountKey, &account)
+		writeInvalidCredentials(w)
+		return
+	}
+
+	// Unverified accounts get the same answer; the owner is emailed a fresh verification link instead
 	if !account.IsEmailVerified {
-		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Email not verified. Please check your email."})
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, AccID: account.AccID, Details: map[string]interface{}{"reason": "email_not_verified"}})
+		remindToVerify(db, mail, account)
+		writeInvalidCredentials(w)
 		return
 	}
 
-	// Check password
-	if !CheckPassword(account.EncryptedPassword, loginDetails.Password) {
-		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+	// The owner reported a login they did not make; the old password stays unusable until it is reset
+	if mustResetPassword {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, AccID: account.AccID, Details: map[string]interface{}{"reason": "password_reset_required"}})
+		utils.WriteJSONResponse(w, http.StatusForbidden, map[string]string{"error": "A password reset is required. Use 'Forgot password' to choose a new one."})
 		return
 	}
+	upgradePasswordHash(r.Context(), db, account, loginDetails.Password)
 
-	// Generate 2FA code using the secret key
-	code, err := totp.GenerateCode(account.SecretKey2FA, time.Now())
+	// A trusted browser has already proven the second factor
+	deviceID, trusted, err := device.CheckTrusted(db, account.AccID, device.TrustedTokenFromRequest(r))
 	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating 2FA code"})
+		log.Printf("Error checking trusted device for account %d: %v", account.AccID, err)
+	}
+	if trusted {
+		audit.Record(db, r, audit.Event{Type: audit.TwoFactorPassed, AccID: account.AccID, Details: map[string]interface{}{"factor": "trusted_device", "deviceID": deviceID}})
+		resetAuthFailures(db, accountKey)
+		completeLogin(w, r, db, mail, account, map[string]interface{}{"message": "Login successful", "TrustedDevice": true})
 		return
 	}
 
-	// Send the 2FA code to the user's email
-	err = send2FACodeEmail(account.Email, code)
+	// Bind the second step to this password check
+	challengeID, challengeExpiry, err := challenge.Create(db, account.AccID, clientIP)
 	if err != nil {
+		log.Printf("Error creating login challenge: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error starting login"})
+		return
+	}
+
+	// Authenticator app users already have the code on their device
+	if account.TwoFactorMethod == TwoFactorMethodTOTP {
+		utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+			"message":          "Please enter the code from your authenticator app.",
+			"TwoFactorMethod":  TwoFactorMethodTOTP,
+			"ChallengeID":      challengeID,
+			"ChallengeExpires": challengeExpiry,
+		})
+		return
+	}
+
+	// Email a single-use login code (a code sent within the cooldown is still valid)
+	err = sendLoginCode(db, mail, account)
+	if err != nil && !errors.Is(err, onetimecode.ErrResendTooSoon) {
 		log.Printf("Error sending 2FA code: %v", err)
 		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending 2FA code"})
 		return
 	}
 
 	// Respond asking the user to enter the 2FA code
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Please check your email for the 2FA code and enter it in the next step.",
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"message":          "Please check your email for the 2FA code and enter it in the next step.",
+		"TwoFactorMethod":  TwoFactorMethodEmail,
+		"ChallengeID":      challengeID,
+		"ChallengeExpires": challengeExpiry,
 	})
 }
 
-func Verify2FAHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// Verify 2FA Handler (Step 2: Check the code against the login challenge)
+func Verify2FAHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
 	var twoFACode struct {
-		Username  string `json:"Username"`
-		TwoFACode string `json:"TwoFACode"`
+		ChallengeID    string `json:"ChallengeID"`
+		TwoFACode      string `json:"TwoFACode"`
+		RecoveryCode   string `json:"RecoveryCode"`   // Alternative to TwoFACode when the usual factor is unavailable
+		RememberDevice bool   `json:"RememberDevice"` // Skip the second factor on this browser from now on
+		DeviceLabel    string `json:"DeviceLabel"`    // Optional name for the trusted device
 	}
 	err := json.NewDecoder(r.Body).Decode(&twoFACode)
 	if err != nil {
@@ -136,11 +258,19 @@ func Verify2FAHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	log.Printf("Received 2FA verification request: Username=%s, Code=%s", twoFACode.Username, twoFACode.TwoFACode)
+	clientIP := utils.ClientIP(r)
+	accID, err := challenge.Lookup(db, twoFACode.ChallengeID, clientIP)
+	if err != nil {
+		if err != challenge.ErrInvalidChallenge {
+			log.Printf("Error fetching login challenge: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Login expired. Please log in again."})
+		return
+	}
 
 	var account models.Account
-	err = db.QueryRow("SELECT acc_id, username, email, secretkey_2fa FROM accounts WHERE username = $1", twoFACode.Username).Scan(
-		&account.AccID, &account.UserName, &account.Email, &account.SecretKey2FA,
+	err = db.QueryRow("SELECT acc_id, username, email, secretkey_2fa, two_factor_method FROM accounts WHERE acc_id = $1", accID).Scan(
+		&account.AccID, &account.UserName, &account.Email, &account.SecretKey2FA, &account.TwoFactorMethod,
 	)
 	if err != nil {
 		log.Printf("Error fetching account: %v", err)
@@ -148,24 +278,153 @@ func Verify2FAHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	log.Printf("Fetched user: Username=%s, SecretKey2FA=%s", account.UserName, account.SecretKey2FA)
+	accountKey := lockout.AccountKey(account.UserName)
+	if rejectIfBlocked(w, db, clientIP, accountKey) {
+		audit.Record(db, r, audit.Event{Type: audit.TwoFactorFailed, AccID: account.AccID, Details: map[string]interface{}{"reason": "blocked"}})
+		return
+	}
 
-	if !Verify2FACode(account.SecretKey2FA, twoFACode.TwoFACode) {
+	usedRecoveryCode := twoFACode.RecoveryCode != ""
+	factor := account.TwoFactorMethod
+	if usedRecoveryCode {
+		factor = "recovery_code"
+	}
+	err = verifySecondFactor(db, account, twoFACode.TwoFACode, twoFACode.RecoveryCode)
+	switch {
+	case err == nil:
+	case errors.Is(err, onetimecode.ErrInvalidCode):
 		log.Printf("Invalid 2FA code for user: %s", account.UserName)
+		audit.Record(db, r, audit.Event{Type: audit.TwoFactorFailed, AccID: account.AccID, Details: map[string]interface{}{"factor": factor, "reason": "invalid_code"}})
+		recordAuthFailure(r, db, mail, accountKey, &account)
 		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Invalid 2FA code"})
 		return
+	case errors.Is(err, onetimecode.ErrNoActiveCode), errors.Is(err, onetimecode.ErrTooManyAttempts):
+		log.Printf("2FA code unusable for user %s: %v", account.UserName, err)
+		audit.Record(db, r, audit.Event{Type: audit.TwoFactorFailed, AccID: account.AccID, Details: map[string]interface{}{"factor": factor, "reason": "code_unusable"}})
+		recordAuthFailure(r, db, mail, accountKey, &account)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "2FA code expired or used too many times. Please log in again."})
+		return
+	default:
+		log.Printf("Error verifying 2FA code for user %s: %v", account.UserName, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error verifying 2FA code"})
+		return
+	}
+
+	// The challenge is single-use, so a concurrent request with the same challenge loses here
+	if err := challenge.Consume(db, twoFACode.ChallengeID); err != nil {
+		if err != challenge.ErrInvalidChallenge {
+			log.Printf("Error consuming login challenge: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Login expired. Please log in again."})
+		return
 	}
 
 	log.Printf("2FA verified successfully for user: %s", account.UserName)
+	audit.Record(db, r, audit.Event{Type: audit.TwoFactorPassed, AccID: account.AccID, Details: map[string]interface{}{"factor": factor}})
+	resetAuthFailures(db, accountKey)
+
+	response := map[string]interface{}{"message": "Login successful"}
+	if usedRecoveryCode {
+		remaining, err := recoverycode.Remaining(db, account.AccID)
+		if err != nil {
+			log.Printf("Error counting recovery codes for user %s: %v", account.UserName, err)
+		} else {
+			response["RecoveryCodesRemaining"] = remaining
+		}
+	}
 
-	session.GenerateRandomSessions(db, account.AccID)
+	// Let this browser skip the second factor next time when the user asked for it
+	if twoFACode.RememberDevice {
+		rememberDevice(w, r, db, account, twoFACode.DeviceLabel)
+	}
+
+	completeLogin(w, r, db, mail, account, response)
+}
+
+// Start a session once every factor has passed and send it to the client along with the given response fields
+func completeLogin(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail, account models.Account, response map[string]interface{}) {
+	sess, token, err := session.CreateSession(db, account.AccID, utils.ClientIP(r), r.UserAgent())
+	if err != nil {
+		log.Printf("Error creating session for user %s: %v", account.UserName, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error creating session"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.LoginSucceeded, AccID: account.AccID, Details: map[string]interface{}{"sessionID": sess.SessionID}})
+	notifyIfNewDevice(r, db, mail, account)
 	scores.GenerateScoresForLoggedInUser(db, account.AccID)
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Login successful"})
+	// Emailed-code accounts get no setup step of their own, so their first full login hands out recovery codes
+	codes, err := recoverycode.GenerateIfMissing(db, account.AccID)
+	if err != nil {
+		log.Printf("Error issuing recovery codes for user %s: %v", account.UserName, err)
+	} else if codes != nil {
+		response["RecoveryCodes"] = codes
+		response["message"] = "Login successful. Store these recovery codes somewhere safe; each one signs you in once if you lose access to your email."
+	}
+
+	response["token"] = token
+	response["expiresAt"] = sess.ExpiryDateTime
+	session.SetCookie(w, token, sess.ExpiryDateTime)
+	utils.WriteJSONResponse(w, http.StatusOK, response)
 }
 
-// Register Handler
-func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+// Check the second factor: a recovery code if one was given, otherwise the account's configured method
+func verifySecondFactor(db *sql.DB, account models.Account, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		ok, err := recoverycode.Consume(db, account.AccID, recoveryCode)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return onetimecode.ErrInvalidCode
+		}
+		return nil
+	}
+
+	// Authenticator app codes are checked against the TOTP secret, emailed codes against the one-time code store
+	if account.TwoFactorMethod == TwoFactorMethodTOTP {
+		secret, err := secrets.Decrypt(account.SecretKey2FA)
+		if err != nil {
+			return fmt.Errorf("decrypting TOTP secret: %w", err)
+		}
+		step, ok := totpStep(secret, code, time.Now())
+		if !ok {
+			return onetimecode.ErrInvalidCode
+		}
+
+		// A code seen by an attacker stays valid for its whole window, so it must not work a second time
+		accepted, err := acceptTOTPStep(db, account.AccID, step)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return onetimecode.ErrInvalidCode
+		}
+		return nil
+	}
+	return onetimecode.Verify(db, account.AccID, onetimecode.PurposeLogin, code)
+}
+
+// Current Account Handler
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"AccID":    account.AccID,
+		"Username": account.UserName,
+		"Email":    account.Email,
+		"Role":     account.Role,
+	})
+}
+
+// Register Handler (always answers 202 once the input is valid; a taken username or email is reported by email
+// to the address given rather than with a 409, so registration cannot be used to find out who has an account.
+// The unique indexes still decide the outcome, and a 409 remains only for confirming an email change.)
+func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
 	// Extract account details
 	var accountDetails struct {
 		Username string `json:"Username"`
@@ -178,64 +437,134 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	// Check if username already exists
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM accounts WHERE username = $1", accountDetails.Username).Scan(&count)
-	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error checking username"})
+	// Store the NFKC form so lookalike characters cannot produce distinct accounts
+	accountDetails.Username = validation.Normalize(accountDetails.Username)
+	accountDetails.Email = validation.Normalize(accountDetails.Email)
+
+	// Validate all fields up front so the client can show every problem at once
+	if errs := validation.Registration(accountDetails.Username, accountDetails.Email, accountDetails.Password); len(errs) > 0 {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, errs.Body())
 		return
 	}
 
-	if count > 0 {
-		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Username already taken"})
+	// Every attempt sends an email, so limit how many a single client can trigger
+	if cache.Hit("register:"+utils.ClientIP(r), config.RegistrationIPWindow) > config.RegistrationsPerIP {
+		w.Header().Set("Retry-After", strconv.Itoa(int(config.RegistrationIPWindow.Seconds())))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests. Please try again later."})
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := HashPassword(accountDetails.Password)
+	// Hash password (also when the registration is going to be rejected, so every outcome takes as long)
+	hashedPassword, err := HashPassword(r.Context(), accountDetails.Password)
 	if err != nil {
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error hashing password"})
+		writeHashingError(w, err)
 		return
 	}
 
 	// Generate 2FA secret (but don't store it in the account yet)
-	secret, _, err := Generate2FASecret()
+	secret, _, err := Generate2FASecret(accountDetails.Email)
 	if err != nil {
 		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating 2FA secret"})
 		return
 	}
+	sealedSecret, err := secrets.Encrypt(secret)
+	if err != nil {
+		log.Printf("Error encrypting 2FA secret: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating 2FA secret"})
+		return
+	}
+
+	// Whatever happens next, the client only learns that an email is on its way; the inbox gets the real outcome
+	respond := func(emailID string) {
+		utils.WriteJSONResponse(w, http.StatusAccepted, map[string]string{
+			"message": "Thanks! Please check your email to finish creating your account.",
+			"EmailID": emailID, // Poll /emails/{id} for delivery status
+		})
+	}
+
+	// The email's owner already has an account; tell them rather than the client
+	var existingID uint64
+	var existingEmail string
+	err = db.QueryRow("SELECT acc_id, email FROM accounts WHERE email_key = $1", validation.Key(accountDetails.Email)).Scan(&existingID, &existingEmail)
+	if err == nil {
+		respond(rejectRegistration(db, mail, r, existingID, existingEmail, mailer.TemplateAccountExists, map[string]interface{}{"Link": config.FrontendBaseURL + "/login"}))
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error checking email for registration: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error creating account"})
+		return
+	}
 
 	// Generate unique verification token
 	verificationToken := uuid.New().String()
 
-	// Insert new account into the database (without secretkey_2fa, is_email_verified = false)
-	var accID uint64
-	err = db.QueryRow("INSERT INTO accounts (username, email, encrypted_password) VALUES ($1, $2, $3) RETURNING acc_id", accountDetails.Username, accountDetails.Email, hashedPassword).Scan(&accID)
+	// Uniqueness is enforced by the database so concurrent registrations cannot both succeed
+	accID, err := createAccount(db, accountDetails.Username, accountDetails.Email, hashedPassword, verificationToken, sealedSecret)
+	if constraint, ok := utils.UniqueViolation(err); ok {
+		switch constraint {
+		case config.UsernameKeyIndex:
+			respond(rejectRegistration(db, mail, r, 0, accountDetails.Email, mailer.TemplateUsernameTaken, map[string]interface{}{
+				"Username": accountDetails.Username,
+				"Link":     config.FrontendBaseURL + "/register",
+			}))
+		default:
+			// Lost a race with another registration for the same email
+			respond(rejectRegistration(db, mail, r, 0, accountDetails.Email, mailer.TemplateAccountExists, map[string]interface{}{"Link": config.FrontendBaseURL + "/login"}))
+		}
+		return
+	}
 	if err != nil {
+		log.Printf("Error creating account: %v", err)
 		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error creating account"})
 		return
 	}
 
-	// Store verification token and secret temporarily (using database)
-	_, err = db.Exec("INSERT INTO email_verifications (acc_id, verification_token, secret_key_2fa) VALUES ($1, $2, $3)", accID, verificationToken, secret)
+	audit.Record(db, r, audit.Event{Type: audit.AccountRegistered, AccID: accID})
+
+	// Queue verification email; the account exists either way, so a mail problem never fails the request
+	verificationLink := fmt.Sprintf("%s/verify-email?token=%s", config.APIBaseURL, verificationToken)
+	emailID, err := mail.queueTemplate(accountDetails.Email, mailer.TemplateVerifyEmail, map[string]interface{}{
+		"Link":      verificationLink,
+		"ExpiresIn": humanDuration(config.VerificationTokenLifetime),
+	})
+	if err != nil {
+		log.Printf("Error queueing verification email: %v", err)
+	}
+	respond(emailID)
+}
+
+// Insert an unverified account together with its verification token and pending 2FA secret, so neither exists without the other
+func createAccount(db *sql.DB, username, email, hashedPassword, verificationToken, sealedSecret string) (uint64, error) {
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error storing verification data: %v", err)
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error storing verification data"})
-		return
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	// Send verification email
-	verificationLink := fmt.Sprintf("http://localhost:8080/verify-email?token=%s", verificationToken)
-	err = sendVerificationEmail(accountDetails.Email, verificationLink)
+	var accID uint64
+	err = tx.QueryRow("INSERT INTO accounts (username, email, username_key, email_key, encrypted_password) VALUES ($1, $2, $3, $4, $5) RETURNING acc_id",
+		username, email, validation.Key(username), validation.Key(email), hashedPassword).Scan(&accID)
 	if err != nil {
-		log.Printf("Error sending verification email: %v", err)
-		// Consider how to handle this - maybe allow resending or manual verification
-		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending verification email"})
-		return
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO email_verifications (acc_id, verification_token, secret_key_2fa) VALUES ($1, $2, $3)", accID, verificationToken, sealedSecret)
+	if err != nil {
+		return 0, err
 	}
+	return accID, tx.Commit()
+}
+
+// Email the outcome of a registration that did not create an account, returning the delivery tracking ID
+func rejectRegistration(db *sql.DB, mail *Mail, r *http.Request, existingID uint64, toEmail, template string, data map[string]interface{}) string {
+	audit.Record(db, r, audit.Event{Type: audit.RegistrationRejected, AccID: existingID, Details: map[string]interface{}{"reason": template}})
 
-	// Respond with success message
-	utils.WriteJSONResponse(w, http.StatusCreated, map[string]string{"message": "Account created. Please check your email to verify your account."})
+	emailID, err := mail.queueTemplate(toEmail, template, data)
+	if err != nil {
+		log.Printf("Error queueing %s email: %v", template, err)
+	}
+	return emailID
 }
 
 // Verify Email Handler
@@ -246,10 +575,17 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	// Retrieve verification data from the database
+	// Malformed tokens can never match
+	if _, err := uuid.Parse(token); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	// Retrieve verification data from the database, ignoring tokens past their lifetime
 	var accID uint64
-	var secretKey2FA string
-	err := db.QueryRow("SELECT acc_id, secret_key_2fa FROM email_verifications WHERE verification_token = $1", token).Scan(&accID, &secretKey2FA)
+	var secretKey2FA, newEmail sql.NullString
+	err := db.QueryRow("SELECT acc_id, secret_key_2fa, new_email FROM email_verifications WHERE verification_token = $1 AND created_at > NOW() - $2 * INTERVAL '1 second'",
+		token, int(config.VerificationTokenLifetime.Seconds())).Scan(&accID, &secretKey2FA, &newEmail)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired verification token"})
@@ -260,14 +596,32 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	// Mark email as verified and store the 2FA secret
-	_, err = db.Exec("UPDATE accounts SET is_email_verified = TRUE, secretkey_2fa = $1 WHERE acc_id = $2", secretKey2FA, accID)
+	if newEmail.Valid {
+		// Email change: the new address is only applied once it has been confirmed
+		_, err = db.Exec("UPDATE accounts SET email = $1, email_key = $2 WHERE acc_id = $3", newEmail.String, validation.Key(newEmail.String), accID)
+		if errs := takenFields(err); len(errs) > 0 {
+			utils.WriteJSONResponse(w, http.StatusConflict, errs.Body())
+			return
+		}
+	} else {
+		// Mark email as verified and store the 2FA secret
+		_, err = db.Exec("UPDATE accounts SET is_email_verified = TRUE, secretkey_2fa = $1 WHERE acc_id = $2", secretKey2FA.String, accID)
+	}
 	if err != nil {
 		log.Printf("Error updating account during verification: %v", err)
 		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error verifying account"})
 		return
 	}
 
+	if newEmail.Valid {
+		audit.Record(db, r, audit.Event{Type: audit.EmailChanged, AccID: accID})
+		if err := session.InvalidateAccount(db, accID); err != nil {
+			log.Printf("Error invalidating cached sessions for account %d: %v", accID, err)
+		}
+	} else {
+		audit.Record(db, r, audit.Event{Type: audit.EmailVerified, AccID: accID})
+	}
+
 	// Optionally, delete the verification record
 	_, err = db.Exec("DELETE FROM email_verifications WHERE verification_token = $1", token)
 	if err != nil {
@@ -275,52 +629,23 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// Redirect to login page
-	loginURL := "http://localhost:5173/login" // Redirect to frontend login URL
+	loginURL := config.FrontendBaseURL + "/login" // Redirect to frontend login URL
 	http.Redirect(w, r, loginURL, http.StatusFound)
 }
 
-func send2FACodeEmail(toEmail, code string) error {
-	// Load environment variables
-	err := loadEnvVariables()
-	if err != nil {
-		return fmt.Errorf("error loading environment variables: %v", err)
+// Map a unique violation on the account keys to field errors, returning nil for any other error
+func takenFields(err error) validation.Errors {
+	constraint, ok := utils.UniqueViolation(err)
+	if !ok {
+		return nil
 	}
 
-	from := os.Getenv("SMTP_FROM") // Read from the .env file
-	password := os.Getenv("SMTP_PASSWORD")
-	smtpServer := os.Getenv("SMTP_SERVER")
-	smtpPort := os.Getenv("SMTP_PORT")
-
-	subject := "Your 2FA Code"
-	body := fmt.Sprintf("Your 2FA code is: %s", code)
-
-	message := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", toEmail, subject, body))
-
-	auth := smtp.PlainAuth("", from, password, smtpServer)
-
-	err = smtp.SendMail(smtpServer+":"+smtpPort, auth, from, []string{toEmail}, message)
-	return err
-}
-
-func sendVerificationEmail(toEmail, verificationLink string) error {
-	// Load environment variables
-	err := loadEnvVariables()
-	if err != nil {
-		return fmt.Errorf("error loading environment variables: %v", err)
+	var errs validation.Errors
+	switch constraint {
+	case config.UsernameKeyIndex:
+		errs.Add("Username", "Is already taken")
+	case config.EmailKeyIndex:
+		errs.Add("Email", "Is already registered")
 	}
-
-	from := os.Getenv("SMTP_FROM") // Read from the .env file
-	password := os.Getenv("SMTP_PASSWORD")
-	smtpServer := os.Getenv("SMTP_SERVER")
-	smtpPort := os.Getenv("SMTP_PORT")
-
-	subject := "Verify Your Account"
-	body := fmt.Sprintf("Click the following link to verify your account: %s", verificationLink)
-
-	message := []byte(fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", toEmail, subject, body))
-
-	auth := smtp.PlainAuth("", from, password, smtpServer)
-
-	err = smtp.SendMail(smtpServer+":"+smtpPort, auth, from, []string{toEmail}, message)
-	return err
+	return errs
 }
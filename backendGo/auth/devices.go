@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"backendGo/audit"
+	"backendGo/config"
+	"backendGo/device"
+	"backendGo/magiclink"
+	"backendGo/models"
+	"backendGo/session"
+	"backendGo/utils"
+)
+
+// Remember the device a login completed from and email the owner when it has not been seen before
+func notifyIfNewDevice(r *http.Request, db *sql.DB, mail *Mail, account models.Account) {
+	clientIP := utils.ClientIP(r)
+	fp := device.NewFingerprint(clientIP, r.UserAgent())
+
+	isNew, hadDevices, err := device.Remember(db, account.AccID, fp)
+	if err != nil {
+		log.Printf("Error remembering device for account %d: %v", account.AccID, err)
+		return
+	}
+	// The first device an account ever uses is not news to its owner
+	if !isNew || !hadDevices {
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.NewDeviceLogin, AccID: account.AccID, Details: map[string]interface{}{"browser": fp.Browser, "os": fp.OS, "ipRange": fp.IPRange}})
+
+	token, err := device.IssueAlertToken(db, account.AccID)
+	if err != nil {
+		log.Printf("Error issuing device alert token for account %d: %v", account.AccID, err)
+		return
+	}
+	notMeLink := fmt.Sprintf("%s/not-me?token=%s", config.FrontendBaseURL, token)
+	if err := mail.sendNewDeviceNotice(account.Email, fp, clientIP, notMeLink); err != nil {
+		log.Printf("Error sending new device notice for account %d: %v", account.AccID, err)
+	}
+}
+
+// Not Me Page Handler (forwards links from older notices to the confirmation page; a GET never changes anything, since mail scanners follow links)
+func NotMePageHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, fmt.Sprintf("%s/not-me?token=%s", config.FrontendBaseURL, url.QueryEscape(r.URL.Query().Get("token"))), http.StatusFound)
+}
+
+// Not Me Handler (confirmed from a new-device notice: sign out everywhere and require a new password)
+func NotMeHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var notMeDetails struct {
+		Token string `json:"Token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&notMeDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	accID, err := device.RedeemAlertToken(db, notMeDetails.Token)
+	if err == device.ErrInvalidAlertToken {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error redeeming device alert token: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error securing account"})
+		return
+	}
+
+	// Lock the current password out before ending sessions so the intruder cannot simply log in again
+	_, err = db.Exec("UPDATE accounts SET must_reset_password = TRUE WHERE acc_id = $1", accID)
+	if err != nil {
+		log.Printf("Error requiring password reset for account %d: %v", accID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error securing account"})
+		return
+	}
+	if _, err := db.Exec("DELETE FROM login_challenges WHERE acc_id = $1", accID); err != nil {
+		log.Printf("Error clearing login challenges for account %d: %v", accID, err)
+	}
+	if _, err := session.RevokeAll(db, accID); err != nil {
+		log.Printf("Error revoking sessions for account %d: %v", accID, err)
+	}
+	if err := device.ForgetAll(db, accID); err != nil {
+		log.Printf("Error forgetting devices for account %d: %v", accID, err)
+	}
+	if _, err := device.RevokeAllTrusted(db, accID); err != nil {
+		log.Printf("Error revoking trusted devices for account %d: %v", accID, err)
+	}
+	if err := magiclink.RevokeAll(db, accID); err != nil {
+		log.Printf("Error revoking sign-in links for account %d: %v", accID, err)
+	}
+	audit.Record(db, r, audit.Event{Type: audit.CompromiseReported, AccID: accID})
+
+	// The alert link is long-lived, so it never doubles as a reset link; the owner goes through the usual forgot-password flow
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Your account has been secured and every device was signed out. Request a password reset to choose a new password."})
+}
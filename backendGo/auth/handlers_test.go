@@ -0,0 +1,335 @@
+package auth_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"backendGo/auth"
+	"backendGo/cache"
+	"backendGo/config"
+	"backendGo/database"
+	"backendGo/lockout"
+	"backendGo/mailer"
+	"backendGo/secrets"
+
+	_ "github.com/lib/pq"
+)
+
+// The handler tests talk to a real database; point TEST_DATABASE_URL at a throwaway one to run them
+const testDatabaseEnv = "TEST_DATABASE_URL"
+
+const (
+	testPassword  = "Tangerine42x!"
+	firefoxLinux  = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	chromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+)
+
+var (
+	tokenPattern     = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+	loginCodePattern = regexp.MustCompile(`login code is: (\d+)`)
+)
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request)
+
+// Database, in-memory outbox and mail sender shared by the handlers under test
+type harness struct {
+	db    *sql.DB
+	inbox *mailer.MemoryMailer
+	mail  *auth.Mail
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	url := os.Getenv(testDatabaseEnv)
+	if url == "" {
+		t.Skipf("%s not set; skipping handler test", testDatabaseEnv)
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("connect to database: %v", err)
+	}
+	database.CreateTables(db)
+	database.MigrateAccountKeys(db)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	t.Setenv("ENCRYPTION_KEYS", "test:"+base64.StdEncoding.EncodeToString(key))
+	if err := secrets.LoadFromEnv(); err != nil {
+		t.Fatalf("load encryption keys: %v", err)
+	}
+	cache.InitializeCache()
+
+	inbox := mailer.NewMemoryMailer()
+	return &harness{db: db, inbox: inbox, mail: auth.NewMail(inbox, mailer.NewRenderer("", config.AppName))}
+}
+
+// Send a request from the given client and record the response
+func call(handler handlerFunc, method, target string, body interface{}, ip, userAgent string) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	r := httptest.NewRequest(method, target, &payload)
+	r.RemoteAddr = ip + ":40000"
+	r.Header.Set("User-Agent", userAgent)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// Wait for an email whose subject contains the given text, since some flows send in the background
+func (h *harness) waitForMail(t *testing.T, to, subject string) mailer.Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, msg := range h.inbox.Messages() {
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				return msg
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q email sent to %s; got %d other messages", subject, to, len(h.inbox.Messages()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Report whether any email whose subject contains the given text was sent to the address
+func (h *harness) mailed(to, subject string) bool {
+	for _, msg := range h.inbox.Messages() {
+		if msg.To == to && strings.Contains(msg.Subject, subject) {
+			return true
+		}
+	}
+	return false
+}
+
+func find(t *testing.T, pattern *regexp.Regexp, msg mailer.Message) string {
+	t.Helper()
+	match := pattern.FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("email %q does not match %s:\n%s", msg.Subject, pattern, msg.Body)
+	}
+	return match[1]
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func wantStatus(t *testing.T, step string, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("%s: status = %d, want %d; body %s", step, w.Code, want, w.Body.String())
+	}
+}
+
+// Unique username, email and client address so tests never share accounts or rate limits
+type client struct {
+	username, email, ip string
+}
+
+func newClient() client {
+	b := make([]byte, 6)
+	rand.Read(b)
+	suffix := hex.EncodeToString(b)
+	return client{username: "t" + suffix, email: "t" + suffix + "@example.com", ip: fmt.Sprintf("10.%d.%d.%d", b[0], b[1], b[2])}
+}
+
+// Register through the handler and follow the emailed verification link
+func (h *harness) verifiedAccount(t *testing.T, c client) {
+	t.Helper()
+	register := func(w http.ResponseWriter, r *http.Request) { auth.RegisterHandler(w, r, h.db, h.mail) }
+	w := call(register, http.MethodPost, "/register", map[string]string{"Username": c.username, "Email": c.email, "Password": testPassword}, c.ip, firefoxLinux)
+	wantStatus(t, "register", w, http.StatusAccepted)
+
+	token := find(t, tokenPattern, h.waitForMail(t, c.email, "Verify your"))
+	verify := func(w http.ResponseWriter, r *http.Request) { auth.VerifyEmailHandler(w, r, h.db) }
+	w = call(verify, http.MethodGet, "/verify-email?token="+token, nil, c.ip, firefoxLinux)
+	wantStatus(t, "verify email", w, http.StatusFound)
+}
+
+// Log in with the password and the emailed code, returning the final response
+func (h *harness) login(t *testing.T, c client, password, userAgent string) *httptest.ResponseRecorder {
+	t.Helper()
+	h.inbox.Reset()
+	login := func(w http.ResponseWriter, r *http.Request) { auth.LoginHandler(w, r, h.db, h.mail) }
+	w := call(login, http.MethodPost, "/login", map[string]string{"Username": c.username, "Password": password}, c.ip, userAgent)
+	wantStatus(t, "login", w, http.StatusOK)
+	challengeID, _ := decode(t, w)["ChallengeID"].(string)
+
+	code := find(t, loginCodePattern, h.waitForMail(t, c.email, "login code"))
+	verify := func(w http.ResponseWriter, r *http.Request) { auth.Verify2FAHandler(w, r, h.db, h.mail) }
+	w = call(verify, http.MethodPost, "/verify-2fa", map[string]string{"ChallengeID": challengeID, "TwoFACode": code}, c.ip, userAgent)
+	wantStatus(t, "verify login code", w, http.StatusOK)
+	return w
+}
+
+func TestRegistrationEmailsVerificationLink(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+
+	var verified bool
+	if err := h.db.QueryRow("SELECT is_email_verified FROM accounts WHERE email = $1", c.email).Scan(&verified); err != nil || !verified {
+		t.Errorf("is_email_verified = %v, %v; want true after following the link", verified, err)
+	}
+
+	// The link is single-use
+	verify := func(w http.ResponseWriter, r *http.Request) { auth.VerifyEmailHandler(w, r, h.db) }
+	token := find(t, tokenPattern, h.waitForMail(t, c.email, "Verify your"))
+	w := call(verify, http.MethodGet, "/verify-email?token="+token, nil, c.ip, firefoxLinux)
+	wantStatus(t, "reuse verification link", w, http.StatusBadRequest)
+}
+
+func TestPasswordResetEmailsWorkingLink(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+
+	forgot := func(w http.ResponseWriter, r *http.Request) { auth.ForgotPasswordHandler(w, r, h.db, h.mail) }
+	w := call(forgot, http.MethodPost, "/forgot-password", map[string]string{"Email": c.email}, c.ip, firefoxLinux)
+	wantStatus(t, "forgot password", w, http.StatusOK)
+	token := find(t, tokenPattern, h.waitForMail(t, c.email, "Reset your"))
+
+	reset := func(w http.ResponseWriter, r *http.Request) { auth.ResetPasswordHandler(w, r, h.db) }
+	w = call(reset, http.MethodPost, "/reset-password", map[string]string{"Token": token, "Password": c.username + "Xy9!"}, c.ip, firefoxLinux)
+	wantStatus(t, "password containing the username", w, http.StatusBadRequest)
+
+	newPassword := "Marmalade73?"
+	w = call(reset, http.MethodPost, "/reset-password", map[string]string{"Token": token, "Password": newPassword}, c.ip, firefoxLinux)
+	wantStatus(t, "reset password", w, http.StatusOK)
+	w = call(reset, http.MethodPost, "/reset-password", map[string]string{"Token": token, "Password": "Clementine58!"}, c.ip, firefoxLinux)
+	wantStatus(t, "reuse reset link", w, http.StatusBadRequest)
+
+	h.login(t, c, newPassword, firefoxLinux)
+}
+
+func TestLockoutEmailsUnlockLink(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+
+	// Start one failure short of the lockout so the test does not wait out the backoff
+	_, err := h.db.Exec("INSERT INTO auth_failures (scope, key, failures, last_failure_at) VALUES ($1, $2, $3, NOW())",
+		lockout.ScopeAccount, lockout.AccountKey(c.username), config.AccountLockoutThreshold-1)
+	if err != nil {
+		t.Fatalf("seed failures: %v", err)
+	}
+
+	login := func(w http.ResponseWriter, r *http.Request) { auth.LoginHandler(w, r, h.db, h.mail) }
+	w := call(login, http.MethodPost, "/login", map[string]string{"Username": c.username, "Password": "Wrong-password-1"}, c.ip, firefoxLinux)
+	wantStatus(t, "wrong password", w, http.StatusUnauthorized)
+	token := find(t, tokenPattern, h.waitForMail(t, c.email, "was locked"))
+
+	w = call(login, http.MethodPost, "/login", map[string]string{"Username": c.username, "Password": testPassword}, c.ip, firefoxLinux)
+	wantStatus(t, "login while locked", w, http.StatusLocked)
+
+	unlock := func(w http.ResponseWriter, r *http.Request) { auth.UnlockAccountHandler(w, r, h.db) }
+	w = call(unlock, http.MethodGet, "/unlock?token="+token, nil, c.ip, firefoxLinux)
+	wantStatus(t, "unlock", w, http.StatusFound)
+
+	h.login(t, c, testPassword, firefoxLinux)
+}
+
+func TestNewDeviceNoticeLinkSecuresAccount(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+
+	// The first device an account uses is not news to its owner
+	h.login(t, c, testPassword, firefoxLinux)
+	if h.mailed(c.email, "new sign-in") {
+		t.Fatal("new device notice sent for the account's first device")
+	}
+
+	h.login(t, c, testPassword, chromeWindows)
+	token := find(t, tokenPattern, h.waitForMail(t, c.email, "new sign-in"))
+
+	notMe := func(w http.ResponseWriter, r *http.Request) { auth.NotMeHandler(w, r, h.db) }
+	w := call(notMe, http.MethodPost, "/not-me", map[string]string{"Token": token}, c.ip, chromeWindows)
+	wantStatus(t, "not me", w, http.StatusOK)
+
+	login := func(w http.ResponseWriter, r *http.Request) { auth.LoginHandler(w, r, h.db, h.mail) }
+	w = call(login, http.MethodPost, "/login", map[string]string{"Username": c.username, "Password": testPassword}, c.ip, firefoxLinux)
+	wantStatus(t, "login after reporting the sign-in", w, http.StatusForbidden)
+}
+
+func TestMagicLinkEmailsSignInLink(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+
+	request := func(w http.ResponseWriter, r *http.Request) { auth.MagicLinkRequestHandler(w, r, h.db, h.mail) }
+	w := call(request, http.MethodPost, "/magic-link", map[string]string{"Username": c.username}, c.ip, firefoxLinux)
+	wantStatus(t, "request before opting in", w, http.StatusAccepted)
+
+	if _, err := h.db.Exec("UPDATE accounts SET magic_link_enabled = TRUE WHERE email = $1", c.email); err != nil {
+		t.Fatalf("enable sign-in links: %v", err)
+	}
+	w = call(request, http.MethodPost, "/magic-link", map[string]string{"Username": c.username}, c.ip, firefoxLinux)
+	wantStatus(t, "request", w, http.StatusAccepted)
+	msg := h.waitForMail(t, c.email, "sign-in link")
+	if n := len(h.inbox.Messages()); n != 2 {
+		t.Errorf("sent %d messages, want the verification email and one sign-in link", n)
+	}
+	token := find(t, tokenPattern, msg)
+
+	login := func(w http.ResponseWriter, r *http.Request) { auth.MagicLinkLoginHandler(w, r, h.db, h.mail) }
+	w = call(login, http.MethodPost, "/magic-login", map[string]string{"Token": token}, c.ip, firefoxLinux)
+	wantStatus(t, "sign in by link", w, http.StatusOK)
+	if decode(t, w)["token"] == nil {
+		t.Error("sign-in response carries no session token")
+	}
+
+	w = call(login, http.MethodPost, "/magic-login", map[string]string{"Token": token}, c.ip, firefoxLinux)
+	wantStatus(t, "reuse sign-in link", w, http.StatusUnauthorized)
+}
+
+func TestDuplicateRegistrationIsAnsweredByEmail(t *testing.T) {
+	h := newHarness(t)
+	c := newClient()
+	h.verifiedAccount(t, c)
+	register := func(w http.ResponseWriter, r *http.Request) { auth.RegisterHandler(w, r, h.db, h.mail) }
+
+	// Same email in another case: the owner is told they already have an account
+	other := newClient()
+	w := call(register, http.MethodPost, "/register", map[string]string{"Username": other.username, "Email": strings.ToUpper(c.email), "Password": testPassword}, other.ip, firefoxLinux)
+	wantStatus(t, "register a taken email", w, http.StatusAccepted)
+	h.waitForMail(t, c.email, "You already have")
+
+	// Same username in another case: the new address is asked to pick another one
+	w = call(register, http.MethodPost, "/register", map[string]string{"Username": strings.ToUpper(c.username), "Email": other.email, "Password": testPassword}, other.ip, firefoxLinux)
+	wantStatus(t, "register a taken username", w, http.StatusAccepted)
+	msg := h.waitForMail(t, other.email, "Finish creating")
+	if !strings.Contains(msg.Body, strings.ToUpper(c.username)) {
+		t.Errorf("username taken email does not name the username:\n%s", msg.Body)
+	}
+
+	var accounts int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM accounts WHERE email_key = $1 OR username_key = $2", c.email, c.username).Scan(&accounts); err != nil || accounts != 1 {
+		t.Errorf("found %d accounts, %v; want the original account only", accounts, err)
+	}
+}
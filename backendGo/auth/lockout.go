@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"backendGo/audit"
+	"backendGo/config"
+	"backendGo/lockout"
+	"backendGo/models"
+	"backendGo/utils"
+)
+
+// Refuse the request when the client IP or the account is blocked, reporting whether a response was written; an empty account key checks only the IP
+func rejectIfBlocked(w http.ResponseWriter, db *sql.DB, ipAddress, accountKey string) bool {
+	for _, check := range []struct{ scope, key string }{
+		{lockout.ScopeIP, ipAddress},
+		{lockout.ScopeAccount, accountKey},
+	} {
+		if check.key == "" {
+			continue
+		}
+		block, err := lockout.Check(db, check.scope, check.key)
+		if err != nil {
+			log.Printf("Error checking %s lockout: %v", check.scope, err)
+			continue
+		}
+		if block == nil {
+			continue
+		}
+
+		writeBlocked(w, check.scope, block)
+		return true
+	}
+	return false
+}
+
+// Refuse a blocked attempt; only a locked account gets 423 and the unlock hint, everything else is asked to slow down
+func writeBlocked(w http.ResponseWriter, scope string, block *lockout.Block) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(block.RetryAfter.Seconds()))))
+	if block.Locked && scope == lockout.ScopeAccount {
+		utils.WriteJSONResponse(w, http.StatusLocked, map[string]string{"error": "Account temporarily locked after too many failed attempts. Try again later or use the unlock link sent to your email."})
+		return
+	}
+	utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many failed attempts. Please wait before trying again."})
+}
+
+// Count a failed login or 2FA attempt against the client IP and the account, emailing an unlock link on lockout
+func recordAuthFailure(r *http.Request, db *sql.DB, mail *Mail, accountKey string, account *models.Account) {
+	ipAddress := utils.ClientIP(r)
+	if _, err := lockout.RecordFailure(db, lockout.ScopeIP, ipAddress); err != nil {
+		log.Printf("Error recording failure for IP %s: %v", ipAddress, err)
+	}
+
+	lockedNow, err := lockout.RecordFailure(db, lockout.ScopeAccount, accountKey)
+	if err != nil {
+		log.Printf("Error recording failure for account %s: %v", accountKey, err)
+		return
+	}
+	if !lockedNow || account == nil {
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.AccountLocked, AccID: account.AccID})
+
+	token, err := lockout.IssueUnlockToken(db, accountKey)
+	if err != nil {
+		log.Printf("Error issuing unlock token for account %s: %v", accountKey, err)
+		return
+	}
+	unlockLink := fmt.Sprintf("%s/unlock?token=%s", config.APIBaseURL, token)
+	if err := mail.sendUnlockEmail(account.Email, unlockLink); err != nil {
+		log.Printf("Error sending unlock email for account %s: %v", accountKey, err)
+	}
+}
+
+// Clear the account's failure counter once a login has fully succeeded; the IP counter only expires with its window,
+// so signing in to one account an attacker controls cannot wipe failures spread across other accounts
+func resetAuthFailures(db *sql.DB, accountKey string) {
+	if err := lockout.Reset(db, lockout.ScopeAccount, accountKey); err != nil {
+		log.Printf("Error resetting failures for account %s: %v", accountKey, err)
+	}
+}
+
+// Unlock Account Handler (lifts a lockout from the emailed link)
+func UnlockAccountHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Missing unlock token"})
+		return
+	}
+
+	unlocked, err := lockout.Unlock(db, token)
+	if err != nil {
+		log.Printf("Error unlocking account: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error unlocking account"})
+		return
+	}
+	if !unlocked {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired unlock token"})
+		return
+	}
+
+	// Redirect to login page
+	http.Redirect(w, r, config.FrontendBaseURL+"/login", http.StatusFound)
+}
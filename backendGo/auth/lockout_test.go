@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backendGo/lockout"
+)
+
+func TestWriteBlocked(t *testing.T) {
+	tests := []struct {
+		name           string
+		scope          string
+		block          lockout.Block
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"account backoff", lockout.ScopeAccount, lockout.Block{RetryAfter: 2 * time.Second}, http.StatusTooManyRequests, "2"},
+		{"account locked", lockout.ScopeAccount, lockout.Block{Locked: true, RetryAfter: 15 * time.Minute}, http.StatusLocked, "900"},
+		{"IP backoff", lockout.ScopeIP, lockout.Block{RetryAfter: 4 * time.Second}, http.StatusTooManyRequests, "4"},
+		// A locked IP is not told about an unlock email it will never receive
+		{"IP locked", lockout.ScopeIP, lockout.Block{Locked: true, RetryAfter: time.Minute}, http.StatusTooManyRequests, "60"},
+		{"partial seconds round up", lockout.ScopeAccount, lockout.Block{RetryAfter: 1500 * time.Millisecond}, http.StatusTooManyRequests, "2"},
+		{"under a second rounds up", lockout.ScopeIP, lockout.Block{RetryAfter: time.Millisecond}, http.StatusTooManyRequests, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeBlocked(rec, tt.scope, &tt.block)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"backendGo/challenge"
+	"backendGo/models"
+	"backendGo/onetimecode"
+	"backendGo/utils"
+)
+
+// Issue a single-use login code for the account and email it
+func sendLoginCode(db *sql.DB, mail *Mail, account models.Account) error {
+	code, err := onetimecode.Issue(db, account.AccID, onetimecode.PurposeLogin)
+	if err != nil {
+		return err
+	}
+	return mail.send2FACodeEmail(account.Email, code)
+}
+
+// Resend 2FA Code Handler (emails a fresh login code once the cooldown has passed)
+func Resend2FACodeHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	var resendDetails struct {
+		ChallengeID string `json:"ChallengeID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resendDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	accID, err := challenge.Lookup(db, resendDetails.ChallengeID, utils.ClientIP(r))
+	if err != nil {
+		if err != challenge.ErrInvalidChallenge {
+			log.Printf("Error fetching login challenge: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Login expired. Please log in again."})
+		return
+	}
+
+	var account models.Account
+	err = db.QueryRow("SELECT acc_id, username, email, two_factor_method FROM accounts WHERE acc_id = $1", accID).Scan(
+		&account.AccID, &account.UserName, &account.Email, &account.TwoFactorMethod,
+	)
+	if err != nil {
+		log.Printf("Error fetching account: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending 2FA code"})
+		return
+	}
+
+	// Only resend while the password step's code is still live
+	active := false
+	if account.TwoFactorMethod != TwoFactorMethodTOTP {
+		active, err = onetimecode.HasActive(db, account.AccID, onetimecode.PurposeLogin)
+		if err != nil {
+			log.Printf("Error checking login code for user %s: %v", account.UserName, err)
+			utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending 2FA code"})
+			return
+		}
+	}
+	if !active {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "No login in progress. Please log in again."})
+		return
+	}
+
+	err = sendLoginCode(db, mail, account)
+	var cooldown *onetimecode.CooldownError
+	if errors.As(err, &cooldown) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.RetryAfter.Seconds()))))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Please wait before requesting another code"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error resending 2FA code: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error sending 2FA code"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "A new 2FA code has been sent to your email."})
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backendGo/audit"
+	"backendGo/cache"
+	"backendGo/config"
+	"backendGo/lockout"
+	"backendGo/magiclink"
+	"backendGo/models"
+	"backendGo/session"
+	"backendGo/utils"
+)
+
+// Fetch the account matching the condition along with the flags deciding whether it may sign in by link
+func magicLinkAccount(db *sql.DB, query string, arg interface{}) (models.Account, bool, error) {
+	var account models.Account
+	var mustResetPassword, enabled bool
+	err := db.QueryRow("SELECT acc_id, username, email, is_email_verified, two_factor_method, must_reset_password, magic_link_enabled FROM accounts WHERE "+query, arg).Scan(
+		&account.AccID, &account.UserName, &account.Email, &account.IsEmailVerified, &account.TwoFactorMethod, &mustResetPassword, &enabled,
+	)
+	if err != nil {
+		return models.Account{}, false, err
+	}
+
+	// A link proves control of the inbox only, so it stands in for the password and the email code but never for an authenticator app
+	allowed := enabled && account.IsEmailVerified && !mustResetPassword && account.TwoFactorMethod != TwoFactorMethodTOTP
+	return account, allowed, nil
+}
+
+// Magic Link Request Handler (emails a single-use sign-in link to accounts that opted in)
+func MagicLinkRequestHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	var requestDetails struct {
+		Username string `json:"Username"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&requestDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Limit how many links a single client can trigger
+	clientIP := utils.ClientIP(r)
+	if cache.Hit("magic-link:"+clientIP, config.MagicLinkIPWindow) > config.MagicLinkRequestsPerIP {
+		w.Header().Set("Retry-After", strconv.Itoa(int(config.MagicLinkIPWindow.Seconds())))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests. Please try again later."})
+		return
+	}
+
+	accountKey := lockout.AccountKey(requestDetails.Username)
+	if rejectIfBlocked(w, db, clientIP, accountKey) {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, Details: map[string]interface{}{"username": requestDetails.Username, "method": "magic_link", "reason": "blocked"}})
+		return
+	}
+
+	// The response never depends on whether the account exists or allows sign-in links
+	response := map[string]string{"message": "If sign-in links are enabled for that account, one has been sent to its email address."}
+
+	account, allowed, err := magicLinkAccount(db, "username_key = $1", accountKey)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching account for sign-in link: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusAccepted, response)
+		return
+	}
+	if !allowed {
+		utils.WriteJSONResponse(w, http.StatusAccepted, response)
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.MagicLinkRequested, AccID: account.AccID})
+
+	// Issue and send in the background so eligible accounts do not answer slower
+	go func() {
+		token, err := magiclink.Issue(db, account.AccID)
+		if err == magiclink.ErrSentTooSoon {
+			return
+		}
+		if err != nil {
+			log.Printf("Error issuing sign-in link for account %d: %v", account.AccID, err)
+			return
+		}
+
+		signInLink := fmt.Sprintf("%s/magic-login?token=%s", config.FrontendBaseURL, token)
+		if err := mail.sendMagicLinkEmail(account.Email, signInLink); err != nil {
+			log.Printf("Error sending sign-in link for account %d: %v", account.AccID, err)
+		}
+	}()
+
+	utils.WriteJSONResponse(w, http.StatusAccepted, response)
+}
+
+// Magic Link Login Handler (redeems an emailed sign-in link and starts a session)
+func MagicLinkLoginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	var loginDetails struct {
+		Token string `json:"Token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&loginDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// The account is unknown until the link is looked up, so only the client IP can be checked first
+	clientIP := utils.ClientIP(r)
+	if rejectIfBlocked(w, db, clientIP, "") {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, Details: map[string]interface{}{"method": "magic_link", "reason": "blocked"}})
+		return
+	}
+
+	accID, err := magiclink.Lookup(db, loginDetails.Token)
+	if err == magiclink.ErrInvalidToken {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, Details: map[string]interface{}{"method": "magic_link", "reason": "invalid_link"}})
+		if _, err := lockout.RecordFailure(db, lockout.ScopeIP, clientIP); err != nil {
+			log.Printf("Error recording failure for IP %s: %v", clientIP, err)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "This sign-in link is invalid or has expired. Please request a new one."})
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up sign-in link: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error signing in"})
+		return
+	}
+
+	account, allowed, err := magicLinkAccount(db, "acc_id = $1", accID)
+	if err != nil {
+		log.Printf("Error fetching account %d: %v", accID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error signing in"})
+		return
+	}
+
+	// A locked account keeps its link, so it still works once the lockout ends
+	accountKey := lockout.AccountKey(account.UserName)
+	if rejectIfBlocked(w, db, clientIP, accountKey) {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, AccID: account.AccID, Details: map[string]interface{}{"method": "magic_link", "reason": "blocked"}})
+		return
+	}
+
+	// The link is single-use, so a concurrent request with the same link loses here
+	if _, err := magiclink.Redeem(db, loginDetails.Token); err != nil {
+		if err != magiclink.ErrInvalidToken {
+			log.Printf("Error redeeming sign-in link: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "This sign-in link is invalid or has expired. Please request a new one."})
+		return
+	}
+
+	// The account may have opted out, switched to an authenticator app or been reported compromised since the link was sent
+	if !allowed {
+		audit.Record(db, r, audit.Event{Type: audit.LoginFailed, AccID: account.AccID, Details: map[string]interface{}{"method": "magic_link", "reason": "magic_link_not_allowed"}})
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Sign-in links are not available for this account. Please log in with your password."})
+		return
+	}
+
+	audit.Record(db, r, audit.Event{Type: audit.TwoFactorPassed, AccID: account.AccID, Details: map[string]interface{}{"factor": "magic_link"}})
+	resetAuthFailures(db, accountKey)
+	completeLogin(w, r, db, mail, account, map[string]interface{}{"message": "Login successful"})
+}
+
+// Magic Link Setting Handler (opts the signed-in account in or out of passwordless sign-in)
+func MagicLinkSettingHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var settingDetails struct {
+		Enabled         bool   `json:"Enabled"`
+		CurrentPassword string `json:"CurrentPassword"` // Required to turn sign-in links on
+	}
+	if err := json.NewDecoder(r.Body).Decode(&settingDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	if settingDetails.Enabled {
+		var twoFactorMethod string
+		err := db.QueryRow("SELECT two_factor_method FROM accounts WHERE acc_id = $1", account.AccID).Scan(&twoFactorMethod)
+		if err != nil {
+			log.Printf("Error fetching account %d: %v", account.AccID, err)
+			utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error updating sign-in links"})
+			return
+		}
+		if twoFactorMethod == TwoFactorMethodTOTP {
+			utils.WriteJSONResponse(w, http.StatusConflict, map[string]string{"error": "Sign-in links cannot replace an authenticator app. Switch to email codes first."})
+			return
+		}
+
+		if !confirmCurrentPassword(w, r, db, mail, account, settingDetails.CurrentPassword) {
+			return
+		}
+	}
+
+	_, err := db.Exec("UPDATE accounts SET magic_link_enabled = $1 WHERE acc_id = $2", settingDetails.Enabled, account.AccID)
+	if err != nil {
+		log.Printf("Error updating sign-in links for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error updating sign-in links"})
+		return
+	}
+	if !settingDetails.Enabled {
+		if err := magiclink.RevokeAll(db, account.AccID); err != nil {
+			log.Printf("Error revoking sign-in links for account %d: %v", account.AccID, err)
+		}
+	}
+	audit.Record(db, r, audit.Event{Type: audit.MagicLinkToggled, AccID: account.AccID, Details: map[string]interface{}{"enabled": settingDetails.Enabled}})
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Sign-in link setting updated", "MagicLinkEnabled": settingDetails.Enabled})
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"backendGo/config"
+	"backendGo/device"
+	"backendGo/mailer"
+)
+
+// Mail renders the auth email templates and hands them to the outgoing mailer
+type Mail struct {
+	mailer    mailer.Mailer
+	templates *mailer.Renderer
+}
+
+// Create the mail sender passed to the auth handlers
+func NewMail(m mailer.Mailer, templates *mailer.Renderer) *Mail {
+	return &Mail{mailer: m, templates: templates}
+}
+
+func (mail *Mail) send2FACodeEmail(toEmail, code string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateLoginCode, map[string]interface{}{
+		"Code":      code,
+		"ExpiresIn": humanDuration(config.LoginCodeLifetime),
+	})
+}
+
+func (mail *Mail) sendVerificationEmail(toEmail, verificationLink string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateVerifyEmail, map[string]interface{}{
+		"Link":      verificationLink,
+		"ExpiresIn": humanDuration(config.VerificationTokenLifetime),
+	})
+}
+
+func (mail *Mail) sendUnlockEmail(toEmail, unlockLink string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateAccountLocked, map[string]interface{}{
+		"Link":      unlockLink,
+		"ExpiresIn": humanDuration(config.LockoutDuration),
+	})
+}
+
+func (mail *Mail) sendPasswordResetEmail(toEmail, resetLink string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplatePasswordReset, map[string]interface{}{
+		"Link":      resetLink,
+		"ExpiresIn": humanDuration(config.PasswordResetLifetime),
+	})
+}
+
+func (mail *Mail) sendEmailChangeNotice(toEmail, newEmail string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateEmailChangeNotice, map[string]interface{}{
+		"NewEmail": newEmail,
+	})
+}
+
+func (mail *Mail) sendPasswordChangedNotice(toEmail string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplatePasswordChanged, nil)
+}
+
+func (mail *Mail) sendNewDeviceNotice(toEmail string, fp device.Fingerprint, ipAddress, notMeLink string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateNewDeviceLogin, map[string]interface{}{
+		"Browser":   fp.Browser,
+		"OS":        fp.OS,
+		"IPAddress": ipAddress,
+		"Time":      time.Now().UTC().Format("2 Jan 2006 15:04 MST"),
+		"Link":      notMeLink,
+		"ExpiresIn": humanDuration(config.DeviceAlertLinkLifetime),
+	})
+}
+
+func (mail *Mail) sendMagicLinkEmail(toEmail, signInLink string) error {
+	return mail.sendTemplate(toEmail, mailer.TemplateMagicLink, map[string]interface{}{
+		"Link":      signInLink,
+		"ExpiresIn": humanDuration(config.MagicLinkLifetime),
+	})
+}
+
+// Render a transactional email template and send it
+func (mail *Mail) sendTemplate(toEmail, name string, data map[string]interface{}) error {
+	_, err := mail.queueTemplate(toEmail, name, data)
+	return err
+}
+
+// Render a transactional email template and send it, returning a delivery tracking ID when the mailer is a queue
+func (mail *Mail) queueTemplate(toEmail, name string, data map[string]interface{}) (string, error) {
+	msg, err := mail.templates.Render(name, toEmail, data)
+	if err != nil {
+		return "", fmt.Errorf("error rendering %s email: %v", name, err)
+	}
+
+	if queue, ok := mail.mailer.(mailer.Queue); ok {
+		return queue.Enqueue(msg)
+	}
+	return "", mail.mailer.Send(msg)
+}
+
+// Format a duration for email copy, e.g. "10 minutes" or "24 hours"
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	case d >= time.Minute:
+		if d < 2*time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	}
+}
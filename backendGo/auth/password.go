@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backendGo/audit"
+	"backendGo/cache"
+	"backendGo/config"
+	"backendGo/lockout"
+	"backendGo/passwordreset"
+	"backendGo/session"
+	"backendGo/utils"
+	"backendGo/validation"
+)
+
+// Forgot Password Handler (emails a reset link if the address belongs to an account)
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	var forgotDetails struct {
+		Email string `json:"Email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&forgotDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Limit how many reset emails a single client can trigger
+	if cache.Hit("password-reset:"+utils.ClientIP(r), config.PasswordResetIPWindow) > config.PasswordResetPerIP {
+		w.Header().Set("Retry-After", strconv.Itoa(int(config.PasswordResetIPWindow.Seconds())))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests. Please try again later."})
+		return
+	}
+
+	// The response never depends on whether the account exists
+	response := map[string]string{"message": "If an account exists for that email, a password reset link has been sent."}
+
+	var accID uint64
+	var email string
+	err = db.QueryRow("SELECT acc_id, email FROM accounts WHERE email_key = $1 AND is_email_verified", validation.Key(forgotDetails.Email)).Scan(&accID, &email)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching account for password reset: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusOK, response)
+		return
+	}
+
+	// Per-account cooldown, applied silently so it cannot be used to probe for accounts
+	token, err := passwordreset.Create(db, accID)
+	if err == passwordreset.ErrSentTooSoon {
+		utils.WriteJSONResponse(w, http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating password reset token for account %d: %v", accID, err)
+		utils.WriteJSONResponse(w, http.StatusOK, response)
+		return
+	}
+
+	// Send in the background so response time does not reveal whether the account exists
+	resetLink := fmt.Sprintf("%s/reset-password?token=%s", config.FrontendBaseURL, token)
+	go func() {
+		if err := mail.sendPasswordResetEmail(email, resetLink); err != nil {
+			log.Printf("Error sending password reset email for account %d: %v", accID, err)
+		}
+	}()
+
+	utils.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// Reset Password Handler (sets a new password from an emailed reset token)
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var resetDetails struct {
+		Token    string `json:"Token"`
+		Password string `json:"Password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resetDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Limit how many tokens a single client can try, since each valid one costs a password hash
+	if cache.Hit("password-reset-submit:"+utils.ClientIP(r), config.PasswordResetIPWindow) > config.PasswordResetSubmitsPerIP {
+		w.Header().Set("Retry-After", strconv.Itoa(int(config.PasswordResetIPWindow.Seconds())))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests. Please try again later."})
+		return
+	}
+
+	// Check the token before hashing so invalid tokens cost no hashing work
+	accID, err := passwordreset.Lookup(db, resetDetails.Token)
+	if err == passwordreset.ErrInvalidToken {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up reset token: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error resetting password"})
+		return
+	}
+
+	var username, email string
+	err = db.QueryRow("SELECT username, email FROM accounts WHERE acc_id = $1", accID).Scan(&username, &email)
+	if err != nil {
+		log.Printf("Error fetching account %d for password reset: %v", accID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error resetting password"})
+		return
+	}
+
+	var errs validation.Errors
+	validation.Password("Password", resetDetails.Password, username, email, &errs)
+	if len(errs) > 0 {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, errs.Body())
+		return
+	}
+
+	hashedPassword, err := HashPassword(r.Context(), resetDetails.Password)
+	if err != nil {
+		writeHashingError(w, err)
+		return
+	}
+
+	// The token may have been used by a concurrent request in the meantime
+	if _, err := passwordreset.Apply(db, resetDetails.Token, hashedPassword); err != nil {
+		if err == passwordreset.ErrInvalidToken {
+			utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid or expired reset token"})
+			return
+		}
+		log.Printf("Error resetting password: %v", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error resetting password"})
+		return
+	}
+
+	// Anyone holding the old password or a session must sign in again
+	if _, err := session.RevokeAll(db, accID); err != nil {
+		log.Printf("Error revoking sessions after password reset for account %d: %v", accID, err)
+	}
+
+	// Proving ownership of the email also lifts any lockout
+	if err := lockout.Reset(db, lockout.ScopeAccount, lockout.AccountKey(username)); err != nil {
+		log.Printf("Error clearing lockout after password reset for account %d: %v", accID, err)
+	}
+
+	audit.Record(db, r, audit.Event{Type: audit.PasswordReset, AccID: accID})
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please log in with your new password."})
+}
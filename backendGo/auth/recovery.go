@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"backendGo/recoverycode"
+	"backendGo/session"
+	"backendGo/utils"
+)
+
+// Recovery Codes Status Handler (shows how many unused recovery codes remain)
+func RecoveryCodesStatusHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	remaining, err := recoverycode.Remaining(db, account.AccID)
+	if err != nil {
+		log.Printf("Error counting recovery codes for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error fetching recovery codes"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]int{"Remaining": remaining})
+}
+
+// Regenerate Recovery Codes Handler (invalidates the old set and returns a new one)
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var regenerateDetails struct {
+		CurrentPassword string `json:"CurrentPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&regenerateDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Fresh codes are a way past the second factor, so a session alone is not enough
+	if !confirmCurrentPassword(w, r, db, mail, account, regenerateDetails.CurrentPassword) {
+		return
+	}
+
+	codes, err := recoverycode.Generate(db, account.AccID)
+	if err != nil {
+		log.Printf("Error generating recovery codes for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating recovery codes"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"message":       "New recovery codes generated. Previous codes no longer work.",
+		"RecoveryCodes": codes,
+	})
+}
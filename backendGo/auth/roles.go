@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"backendGo/audit"
+	"backendGo/roles"
+	"backendGo/session"
+	"backendGo/utils"
+)
+
+// Set Role Handler (admins grant or revoke moderator and admin roles)
+func SetRoleHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	admin, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	accID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid account ID"})
+		return
+	}
+
+	var roleDetails struct {
+		Role string `json:"Role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&roleDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if !roles.Valid(roleDetails.Role) {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Role must be 'player', 'moderator' or 'admin'"})
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always someone left to manage roles
+	if accID == admin.AccID {
+		utils.WriteJSONResponse(w, http.StatusConflict, map[string]string{"error": "You cannot change your own role"})
+		return
+	}
+
+	result, err := db.Exec("UPDATE accounts SET role = $1 WHERE acc_id = $2", roleDetails.Role, accID)
+	if err != nil {
+		log.Printf("Error updating role for account %d: %v", accID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error updating role"})
+		return
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		utils.WriteJSONResponse(w, http.StatusNotFound, map[string]string{"error": "Account not found"})
+		return
+	}
+
+	// Cached sessions carry the old role
+	if err := session.InvalidateAccount(db, accID); err != nil {
+		log.Printf("Error invalidating cached sessions for account %d: %v", accID, err)
+	}
+
+	audit.Record(db, r, audit.Event{Type: audit.RoleChanged, AccID: accID, ActorID: admin.AccID, Details: map[string]interface{}{"role": roleDetails.Role}})
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Role updated", "AccID": accID, "Role": roleDetails.Role})
+}
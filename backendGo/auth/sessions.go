@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"backendGo/audit"
+	"backendGo/models"
+	"backendGo/session"
+	"backendGo/utils"
+
+	"github.com/google/uuid"
+)
+
+// List Sessions Handler (shows every device the account is logged in on)
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	current, ok := session.FromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	sessions, err := session.ListForAccount(db, current.AccID)
+	if err != nil {
+		log.Printf("Error listing sessions for account %d: %v", current.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error listing sessions"})
+		return
+	}
+
+	devices := make([]models.SessionDevice, 0, len(sessions))
+	for _, sess := range sessions {
+		browser, os := session.ParseUserAgent(sess.UserAgent)
+		devices = append(devices, models.SessionDevice{
+			SessionID:  sess.SessionID,
+			CreatedAt:  sess.CreatedAt,
+			LastSeenAt: sess.LastSeenAt,
+			IPAddress:  sess.IPAddress,
+			UserAgent:  sess.UserAgent,
+			Browser:    browser,
+			OS:         os,
+			Current:    sess.SessionID == current.SessionID,
+		})
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"data": devices})
+}
+
+// Logout Handler (ends the current session)
+func LogoutHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	current, ok := session.FromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	_, err := session.Revoke(db, current.AccID, current.SessionID)
+	if err != nil {
+		log.Printf("Error revoking session %s: %v", current.SessionID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error logging out"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.SessionLoggedOut, AccID: current.AccID, Details: map[string]interface{}{"sessionID": current.SessionID}})
+
+	session.ClearCookie(w)
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// Revoke Session Handler (ends one of the account's sessions by ID)
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	current, ok := session.FromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	sessionID := r.PathValue("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+		return
+	}
+
+	found, err := session.Revoke(db, current.AccID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session %s: %v", sessionID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error revoking session"})
+		return
+	}
+	if !found {
+		utils.WriteJSONResponse(w, http.StatusNotFound, map[string]string{"error": "Session not found"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.SessionRevoked, AccID: current.AccID, Details: map[string]interface{}{"sessionID": sessionID}})
+
+	if sessionID == current.SessionID {
+		session.ClearCookie(w)
+	}
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// Revoke All Sessions Handler (logs the account out everywhere)
+func RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	current, ok := session.FromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	count, err := session.RevokeAll(db, current.AccID)
+	if err != nil {
+		log.Printf("Error revoking sessions for account %d: %v", current.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error revoking sessions"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.SessionsRevokedAll, AccID: current.AccID, Details: map[string]interface{}{"revoked": count}})
+
+	session.ClearCookie(w)
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "Logged out everywhere", "revoked": count})
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"backendGo/config"
+	"backendGo/lockout"
+	"backendGo/recoverycode"
+	"backendGo/secrets"
+	"backendGo/session"
+	"backendGo/utils"
+
+	"github.com/pquerna/otp"
+)
+
+// Second factor delivery methods
+const (
+	TwoFactorMethodEmail = "email"
+	TwoFactorMethodTOTP  = "totp"
+)
+
+// Render an otpauth URI as a base64 PNG data URL
+func qrCodeDataURL(otpauthURI string) (string, error) {
+	key, err := otp.NewKeyFromURL(otpauthURI)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := key.Image(config.TOTPQRCodeSize, config.TOTPQRCodeSize)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// TOTP Enroll Handler (Step 1: issue a pending authenticator secret)
+func TOTPEnrollHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var enrollDetails struct {
+		CurrentPassword string `json:"CurrentPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&enrollDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// A session alone must not be enough to replace the second factor
+	if !confirmCurrentPassword(w, r, db, mail, account, enrollDetails.CurrentPassword) {
+		return
+	}
+
+	secret, otpauthURI, err := Generate2FASecret(account.Email)
+	if err != nil {
+		log.Printf("Error generating TOTP secret for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating 2FA secret"})
+		return
+	}
+
+	qrCode, err := qrCodeDataURL(otpauthURI)
+	if err != nil {
+		log.Printf("Error rendering QR code for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating QR code"})
+		return
+	}
+
+	sealedSecret, err := secrets.Encrypt(secret)
+	if err != nil {
+		log.Printf("Error encrypting TOTP secret for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error starting enrollment"})
+		return
+	}
+
+	// Keep the secret pending until the user proves their app produces valid codes
+	_, err = db.Exec("UPDATE accounts SET totp_pending_secret = $1 WHERE acc_id = $2", sealedSecret, account.AccID)
+	if err != nil {
+		log.Printf("Error storing pending TOTP secret for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error starting enrollment"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message":    "Scan the QR code with your authenticator app and confirm with a code.",
+		"Secret":     secret,
+		"OTPAuthURI": otpauthURI,
+		"QRCode":     qrCode,
+	})
+}
+
+// TOTP Confirm Handler (Step 2: activate the pending secret with a valid code)
+func TOTPConfirmHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var confirmDetails struct {
+		Code string `json:"Code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&confirmDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Enrollment codes are guessable like login codes, so they count towards the same backoff and lockout
+	accountKey := lockout.AccountKey(account.UserName)
+	if rejectIfBlocked(w, db, utils.ClientIP(r), accountKey) {
+		return
+	}
+
+	var pendingSecret sql.NullString
+	err := db.QueryRow("SELECT totp_pending_secret FROM accounts WHERE acc_id = $1", account.AccID).Scan(&pendingSecret)
+	if err != nil {
+		log.Printf("Error fetching pending TOTP secret for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error confirming enrollment"})
+		return
+	}
+	if !pendingSecret.Valid || pendingSecret.String == "" {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "No authenticator enrollment in progress"})
+		return
+	}
+
+	secret, err := secrets.Decrypt(pendingSecret.String)
+	if err != nil {
+		log.Printf("Error decrypting pending TOTP secret for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error confirming enrollment"})
+		return
+	}
+
+	step, ok := totpStep(secret, confirmDetails.Code, time.Now())
+	if !ok {
+		recordAuthFailure(r, db, mail, accountKey, &account)
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Invalid 2FA code"})
+		return
+	}
+
+	// The confirming code is spent, so it cannot also be used to log in
+	_, err = db.Exec("UPDATE accounts SET secretkey_2fa = totp_pending_secret, totp_pending_secret = NULL, totp_enabled = TRUE, two_factor_method = $1, totp_last_step = $2 WHERE acc_id = $3", TwoFactorMethodTOTP, step, account.AccID)
+	if err != nil {
+		log.Printf("Error activating TOTP for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error confirming enrollment"})
+		return
+	}
+
+	// Hand out recovery codes as part of setup in case the authenticator is lost
+	codes, err := recoverycode.Generate(db, account.AccID)
+	if err != nil {
+		log.Printf("Error generating recovery codes for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error generating recovery codes"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"message":         "Authenticator app enabled. Store these recovery codes somewhere safe.",
+		"TwoFactorMethod": TwoFactorMethodTOTP,
+		"RecoveryCodes":   codes,
+	})
+}
+
+// Two-Factor Method Handler (choose between emailed codes and the authenticator app)
+func TwoFactorMethodHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	var methodDetails struct {
+		Method          string `json:"Method"`
+		CurrentPassword string `json:"CurrentPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&methodDetails); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+	if methodDetails.Method != TwoFactorMethodEmail && methodDetails.Method != TwoFactorMethodTOTP {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Method must be 'email' or 'totp'"})
+		return
+	}
+
+	// Switching away from the authenticator app weakens the second factor, so a session alone is not enough
+	if !confirmCurrentPassword(w, r, db, mail, account, methodDetails.CurrentPassword) {
+		return
+	}
+
+	var result sql.Result
+	var err error
+	if methodDetails.Method == TwoFactorMethodTOTP {
+		result, err = db.Exec("UPDATE accounts SET two_factor_method = $1 WHERE acc_id = $2 AND totp_enabled", TwoFactorMethodTOTP, account.AccID)
+	} else {
+		result, err = db.Exec("UPDATE accounts SET two_factor_method = $1 WHERE acc_id = $2", TwoFactorMethodEmail, account.AccID)
+	}
+	if err != nil {
+		log.Printf("Error updating 2FA method for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error updating 2FA method"})
+		return
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		utils.WriteJSONResponse(w, http.StatusConflict, map[string]string{"error": "Enroll an authenticator app before selecting it"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "2FA method updated", "TwoFactorMethod": methodDetails.Method})
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"backendGo/config"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTOTPStep(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_700_000_010, 0)
+	period := time.Duration(config.TOTPPeriod) * time.Second
+	codeAt := func(at time.Time) string {
+		code, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{Period: config.TOTPPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1})
+		if err != nil {
+			t.Fatalf("GenerateCodeCustom returned %v", err)
+		}
+		return code
+	}
+	currentStep := now.Unix() / config.TOTPPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", codeAt(now), currentStep, true},
+		{"previous code within drift", codeAt(now.Add(-period)), currentStep - 1, true},
+		{"next code within drift", codeAt(now.Add(period)), currentStep + 1, true},
+		{"code beyond drift", codeAt(now.Add(-2 * period)), 0, false},
+		{"empty code", "", 0, false},
+		{"non-numeric code", "abcdef", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := totpStep(secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("totpStep = %d, %v; want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"backendGo/audit"
+	"backendGo/config"
+	"backendGo/device"
+	"backendGo/models"
+	"backendGo/session"
+	"backendGo/utils"
+
+	"github.com/google/uuid"
+)
+
+// Issue a trusted-device cookie after a completed second factor; failures only cost the user a code next time
+func rememberDevice(w http.ResponseWriter, r *http.Request, db *sql.DB, account models.Account, label string) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		browser, os := session.ParseUserAgent(r.UserAgent())
+		label = browser + " on " + os
+	}
+	if runes := []rune(label); len(runes) > config.TrustedDeviceLabelMaxLen {
+		label = string(runes[:config.TrustedDeviceLabelMaxLen])
+	}
+
+	token, expiresAt, err := device.Trust(db, account.AccID, label, utils.ClientIP(r))
+	if err != nil {
+		log.Printf("Error trusting device for account %d: %v", account.AccID, err)
+		return
+	}
+	device.SetTrustedCookie(w, token, expiresAt)
+	audit.Record(db, r, audit.Event{Type: audit.DeviceTrusted, AccID: account.AccID, Details: map[string]interface{}{"label": label}})
+}
+
+// List Trusted Devices Handler (browsers that may skip the second factor)
+func ListTrustedDevicesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	devices, err := device.ListTrusted(db, account.AccID, device.TrustedTokenFromRequest(r))
+	if err != nil {
+		log.Printf("Error listing trusted devices for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error listing trusted devices"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"data": devices})
+}
+
+// Revoke Trusted Device Handler (requires the second factor again on one browser)
+func RevokeTrustedDeviceHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	deviceID := r.PathValue("id")
+	if _, err := uuid.Parse(deviceID); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid device ID"})
+		return
+	}
+
+	found, err := device.RevokeTrusted(db, account.AccID, deviceID)
+	if err != nil {
+		log.Printf("Error revoking trusted device %s: %v", deviceID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error revoking trusted device"})
+		return
+	}
+	if !found {
+		utils.WriteJSONResponse(w, http.StatusNotFound, map[string]string{"error": "Trusted device not found"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.DeviceTrustRevoked, AccID: account.AccID, Details: map[string]interface{}{"deviceID": deviceID}})
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{"message": "Trusted device revoked"})
+}
+
+// Revoke All Trusted Devices Handler (requires the second factor again everywhere)
+func RevokeAllTrustedDevicesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	account, ok := session.AccountFromContext(r.Context())
+	if !ok {
+		utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		return
+	}
+
+	count, err := device.RevokeAllTrusted(db, account.AccID)
+	if err != nil {
+		log.Printf("Error revoking trusted devices for account %d: %v", account.AccID, err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Error revoking trusted devices"})
+		return
+	}
+	audit.Record(db, r, audit.Event{Type: audit.DeviceTrustRevoked, AccID: account.AccID, Details: map[string]interface{}{"revoked": count}})
+
+	device.ClearTrustedCookie(w)
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{"message": "All trusted devices revoked", "revoked": count})
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backendGo/cache"
+	"backendGo/config"
+	"backendGo/models"
+	"backendGo/utils"
+	"backendGo/validation"
+
+	"github.com/google/uuid"
+)
+
+// Resend Verification Handler (emails a fresh verification link to an unverified account)
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, mail *Mail) {
+	var resendDetails struct {
+		Email string `json:"Email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&resendDetails)
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+		return
+	}
+
+	// Limit how many resends a single client can trigger
+	if cache.Hit("resend-verification:"+utils.ClientIP(r), config.VerificationResendIPWindow) > config.VerificationResendPerIP {
+		w.Header().Set("Retry-After", strconv.Itoa(int(config.VerificationResendIPWindow.Seconds())))
+		utils.WriteJSONResponse(w, http.StatusTooManyRequests, map[string]string{"error": "Too many requests. Please try again later."})
+		return
+	}
+
+	// The response never depends on whether an unverified account exists
+	response := map[string]string{"message": "If an unverified account exists for that email, a new verification link has been sent."}
+
+	var accID uint64
+	var email string
+	var lastSent time.Time
+	err = db.QueryRow(`
+		SELECT a.acc_id, a.email, v.created_at
+		FROM accounts a
+		INNER JOIN email_verifications v ON v.acc_id = a.acc_id AND v.new_email IS NULL
+		WHERE a.email_key = $1 AND NOT a.is_email_verified
+		ORDER BY v.created_at DESC LIMIT 1`, validation.Key(resendDetails.Email)).Scan(&accID, &email, &lastSent)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching account for verification resend: %v", err)
+		}
+		utils.WriteJSONResponse(w, http.StatusOK, response)
+		return
+	}
+
+	resendVerification(db, mail, accID, email, lastSent)
+	utils.WriteJSONResponse(w, http.StatusOK, response)
+}
+
+// Email a fresh verification link to an unverified account, unless one was sent within the cooldown
+func resendVerification(db *sql.DB, mail *Mail, accID uint64, email string, lastSent time.Time) {
+	// Per-account cooldown, applied silently so it cannot be used to probe for accounts
+	if time.Since(lastSent) < config.VerificationResendCooldown {
+		return
+	}
+
+	// Rotate the token so only the newest link works; the pending 2FA secret is kept
+	verificationToken := uuid.New().String()
+	_, err := db.Exec("UPDATE email_verifications SET verification_token = $1, created_at = NOW() WHERE acc_id = $2 AND new_email IS NULL", verificationToken, accID)
+	if err != nil {
+		log.Printf("Error rotating verification token for account %d: %v", accID, err)
+		return
+	}
+
+	verificationLink := fmt.Sprintf("%s/verify-email?token=%s", config.APIBaseURL, verificationToken)
+	go func() {
+		if err := mail.sendVerificationEmail(email, verificationLink); err != nil {
+			log.Printf("Error resending verification email for account %d: %v", accID, err)
+		}
+	}()
+}
+
+// Remind the owner of an unverified account to verify it, for flows that must not reveal the account exists
+func remindToVerify(db *sql.DB, mail *Mail, account models.Account) {
+	var lastSent time.Time
+	err := db.QueryRow("SELECT created_at FROM email_verifications WHERE acc_id = $1 AND new_email IS NULL ORDER BY created_at DESC LIMIT 1", account.AccID).Scan(&lastSent)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error fetching verification for account %d: %v", account.AccID, err)
+		}
+		return
+	}
+	resendVerification(db, mail, account.AccID, account.Email, lastSent)
+}
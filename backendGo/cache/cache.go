@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	"backendGo/config"
 
@@ -42,3 +43,29 @@ func FetchFromCacheOrExecute(cacheKey string, queryFunc func() ([]byte, error))
 	appCache.Set(cacheKey, result, config.CacheExpiration)
 	return result, false, nil
 }
+
+// Get a value from the cache
+func Get(key string) (interface{}, bool) {
+	return appCache.Get(key)
+}
+
+// Store a value in the cache with the given expiration
+func Set(key string, value interface{}, expiration time.Duration) {
+	appCache.Set(key, value, expiration)
+}
+
+// Remove a value from the cache
+func Delete(key string) {
+	appCache.Delete(key)
+}
+
+// Count a hit against a key within a fixed window and return the running total
+func Hit(key string, window time.Duration) int {
+	// Add only succeeds when the window has not started yet
+	_ = appCache.Add(key, 0, window)
+	count, err := appCache.IncrementInt(key, 1)
+	if err != nil {
+		return 1
+	}
+	return count
+}
@@ -0,0 +1,70 @@
+package challenge
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"backendGo/config"
+	"backendGo/utils"
+)
+
+// ErrInvalidChallenge is returned for unknown, expired, consumed or foreign-IP challenges
+var ErrInvalidChallenge = errors.New("invalid or expired login challenge")
+
+// Create a login challenge for an account that has just passed the password step
+func Create(db *sql.DB, accountID uint64, ipAddress string) (string, time.Time, error) {
+	challengeID, err := utils.GenerateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(config.LoginChallengeLifetime)
+	_, err = db.Exec("INSERT INTO login_challenges (challenge_hash, acc_id, ip_address, expires_at) VALUES ($1, $2, $3, $4)",
+		utils.HashToken(challengeID), accountID, ipAddress, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Opportunistically drop challenges that can no longer be used
+	_, _ = db.Exec("DELETE FROM login_challenges WHERE expires_at <= NOW() OR consumed_at IS NOT NULL")
+
+	return challengeID, expiresAt, nil
+}
+
+// Resolve a live challenge issued to the given IP into its account ID without consuming it
+func Lookup(db *sql.DB, challengeID, ipAddress string) (uint64, error) {
+	if challengeID == "" {
+		return 0, ErrInvalidChallenge
+	}
+
+	var accountID uint64
+	var issuedTo string
+	err := db.QueryRow("SELECT acc_id, ip_address FROM login_challenges WHERE challenge_hash = $1 AND consumed_at IS NULL AND expires_at > NOW()",
+		utils.HashToken(challengeID)).Scan(&accountID, &issuedTo)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidChallenge
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if issuedTo != ipAddress {
+		return 0, ErrInvalidChallenge
+	}
+	return accountID, nil
+}
+
+// Mark a challenge as used; only the first caller succeeds
+func Consume(db *sql.DB, challengeID string) error {
+	result, err := db.Exec("UPDATE login_challenges SET consumed_at = NOW() WHERE challenge_hash = $1 AND consumed_at IS NULL AND expires_at > NOW()",
+		utils.HashToken(challengeID))
+	if err != nil {
+		return err
+	}
+
+	if consumed, _ := result.RowsAffected(); consumed == 0 {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
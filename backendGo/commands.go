@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"backendGo/database"
+	"backendGo/roles"
+	"backendGo/validation"
+)
+
+// Maintenance commands, run as `backendGo <command> [args...]`
+var commands = map[string]struct {
+	usage string
+	run   func(db *sql.DB, args []string) error
+}{
+	"reencrypt-secrets": {
+		usage: "Re-encrypt stored 2FA secrets and queued email bodies with the active key (first entry of ENCRYPTION_KEYS)",
+		run:   reencryptSecrets,
+	},
+	"bootstrap-admin": {
+		usage: "Promote the named account to admin; only allowed while no admin exists",
+		run:   bootstrapAdmin,
+	},
+}
+
+// Dispatch a maintenance command, exiting non-zero on failure
+func runCommand(db *sql.DB, name string, args []string) {
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q. Available commands:\n", name)
+		for commandName, c := range commands {
+			fmt.Fprintf(os.Stderr, "  %-20s %s\n", commandName, c.usage)
+		}
+		os.Exit(2)
+	}
+
+	if err := command.run(db, args); err != nil {
+		log.Fatalf("%s failed: %v", name, err)
+	}
+}
+
+// Rotate 2FA secrets onto the active key; retired keys can be dropped from ENCRYPTION_KEYS afterwards
+func reencryptSecrets(db *sql.DB, args []string) error {
+	total, err := database.ReencryptSecrets(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Re-encrypted %d secrets.\n", total)
+	return nil
+}
+
+// Promote the first admin from an existing account, since roles can otherwise only be granted by an admin
+func bootstrapAdmin(db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: bootstrap-admin <username>")
+	}
+
+	// Only promote while there is no admin yet
+	result, err := db.Exec(`
+		UPDATE accounts SET role = $1
+		WHERE username_key = $2 AND NOT EXISTS (SELECT 1 FROM accounts WHERE role = $1)`,
+		roles.Admin, validation.Key(args[0]))
+	if err != nil {
+		return err
+	}
+	if promoted, _ := result.RowsAffected(); promoted == 0 {
+		var admins int
+		if err := db.QueryRow("SELECT COUNT(*) FROM accounts WHERE role = $1", roles.Admin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins > 0 {
+			return fmt.Errorf("an admin already exists; use PUT /admin/accounts/{id}/role instead")
+		}
+		return fmt.Errorf("no account named %q", args[0])
+	}
+
+	fmt.Printf("%s is now an admin.\n", args[0])
+	return nil
+}
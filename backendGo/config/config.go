@@ -2,6 +2,9 @@ package config
 
 import "time"
 
+// Application name shown in emails and authenticator apps
+const AppName = "Kai-RICRYM"
+
 // Cache configuration constants
 const (
 	CacheExpiration      = 5 * time.Minute
@@ -14,3 +17,137 @@ const (
 	DefaultLimit      = 10
 	MaxResultsPerPage = 100
 )
+
+// Session configuration constants
+const (
+	SessionCookieName = "session_token"
+	SessionLifetime   = 24 * time.Hour
+	SessionCacheTTL   = 1 * time.Minute
+	MaxSessionsPerAcc = 5 // Oldest sessions are evicted beyond this many per account
+)
+
+// Two-factor authentication configuration constants
+const (
+	TOTPIssuer        = AppName // Issuer shown in authenticator apps
+	TOTPPeriod        = 30      // Seconds each authenticator code is valid for
+	TOTPSkew          = 1       // Periods of clock drift accepted either side of the current one
+	TOTPQRCodeSize    = 256     // Width and height of the enrollment QR code in pixels
+	RecoveryCodeCount = 10      // Number of recovery codes issued per set
+)
+
+// Emailed login code configuration; overridable from the environment, see Load
+var (
+	LoginCodeLength         = 6
+	LoginCodeLifetime       = 10 * time.Minute
+	LoginCodeMaxAttempts    = 5
+	LoginCodeResendCooldown = 60 * time.Second
+)
+
+// Login challenge configuration constants
+const (
+	LoginChallengeLifetime = 10 * time.Minute // How long the 2FA step stays open after the password check
+)
+
+// Brute-force protection configuration; overridable from the environment, see Load
+var (
+	FailureBackoffThreshold = 3                // Consecutive failures allowed before backoff starts
+	FailureBackoffBase      = 1 * time.Second  // First backoff delay, doubled on each further failure
+	FailureBackoffMax       = 5 * time.Minute  // Upper bound for the backoff delay
+	FailureWindow           = 1 * time.Hour    // Counters start over after this long without failures
+	AccountLockoutThreshold = 10               // Failures before an account is locked out
+	IPLockoutThreshold      = 50               // Failures before a client IP is locked out
+	LockoutDuration         = 15 * time.Minute // How long a lockout lasts unless lifted by email
+)
+
+// Public URLs used in emailed links and redirects
+const (
+	APIBaseURL      = "http://localhost:8080"
+	FrontendBaseURL = "http://localhost:5173"
+)
+
+// Password reset configuration; overridable from the environment, see Load
+var (
+	PasswordResetLifetime     = 30 * time.Minute
+	PasswordResetCooldown     = 2 * time.Minute // Minimum time between reset emails per account
+	PasswordResetPerIP        = 5               // Reset requests allowed per client IP per window
+	PasswordResetSubmitsPerIP = 10              // New-password submissions allowed per client IP per window
+	PasswordResetIPWindow     = 1 * time.Hour   // Window for the per-IP reset limits
+)
+
+// Email verification configuration; overridable from the environment, see Load
+var (
+	VerificationTokenLifetime  = 24 * time.Hour     // Verification links stop working after this long
+	VerificationResendCooldown = 2 * time.Minute    // Minimum time between verification emails per account
+	VerificationResendPerIP    = 5                  // Resend requests allowed per client IP per window
+	VerificationResendIPWindow = 1 * time.Hour      // Window for the per-IP resend limit
+	RegistrationsPerIP         = 10                 // Registration attempts allowed per client IP per window, since each one sends an email
+	RegistrationIPWindow       = 1 * time.Hour      // Window for the per-IP registration limit
+	UnverifiedAccountRetention = 7 * 24 * time.Hour // Unverified accounts older than this are deleted
+	ExpiredRecordPurgeInterval = 1 * time.Hour      // How often expired tokens and abandoned accounts are purged
+)
+
+// Outbound email queue configuration constants
+const (
+	OutboxPollInterval = 5 * time.Second    // How often the worker looks for due messages
+	OutboxBatchSize    = 10                 // Messages claimed per worker pass
+	OutboxLease        = 2 * time.Minute    // How long a claimed message is hidden from other workers
+	OutboxMaxAttempts  = 8                  // Attempts before a message is dead-lettered
+	OutboxRetryBase    = 30 * time.Second   // First retry delay, doubled on each further failure
+	OutboxRetryMax     = 1 * time.Hour      // Upper bound for the retry delay
+	OutboxRetention    = 7 * 24 * time.Hour // Sent and dead-lettered messages older than this are purged
+)
+
+// Account input validation configuration constants
+const (
+	UsernameMinLength      = 3
+	UsernameMaxLength      = 20
+	EmailMaxLength         = 50 // Matches the width of the email columns
+	PasswordMinLength      = 10
+	PasswordMaxLength      = 128 // Bounds the work a single hash can cost
+	PasswordMinCharClasses = 3   // Of lowercase, uppercase, digits and symbols
+)
+
+// Argon2id password hashing parameters; stored hashes with other parameters are upgraded on login.
+// Overridable from the environment, see Load
+var (
+	Argon2Memory      = 64 * 1024 // KiB
+	Argon2Iterations  = 3
+	Argon2Parallelism = 2
+	Argon2SaltLength  = 16
+	Argon2KeyLength   = 32
+)
+
+// Password hashing pool configuration; overridable from the environment, see Load
+var (
+	HashPoolWorkers   = 0  // Hashes run at once; 0 means one per CPU
+	HashPoolQueueSize = 64 // Callers allowed to wait for a worker before requests are turned away
+)
+
+// Unique indexes backing case-insensitive usernames and emails
+const (
+	UsernameKeyIndex = "idx_accounts_username_key"
+	EmailKeyIndex    = "idx_accounts_email_key"
+)
+
+// New-device notification configuration constants
+const (
+	KnownDeviceIPv4Prefix   = 24                 // IPv4 logins within the same /24 count as the same network
+	KnownDeviceIPv6Prefix   = 48                 // IPv6 logins within the same /48 count as the same network
+	DeviceAlertLinkLifetime = 7 * 24 * time.Hour // How long the "this wasn't me" link in a notice stays valid
+)
+
+// Trusted device configuration constants
+const (
+	TrustedDeviceCookieName  = "trusted_device"
+	TrustedDeviceLifetime    = 30 * 24 * time.Hour // How long a browser may skip the second factor
+	TrustedDeviceLabelMaxLen = 50
+	MaxTrustedDevicesPerAcc  = 10 // Oldest trusted devices are dropped beyond this many per account
+)
+
+// Passwordless sign-in configuration; overridable from the environment, see Load
+var (
+	MagicLinkLifetime       = 15 * time.Minute // How long an emailed sign-in link stays valid
+	MagicLinkResendCooldown = 60 * time.Second // Minimum time between sign-in links per account
+	MagicLinkRequestsPerIP  = 10               // Sign-in link requests allowed per client IP per window
+	MagicLinkIPWindow       = 1 * time.Hour    // Window for the per-IP sign-in link limit
+)
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Override the tunable settings with any values set in the environment; call once, after .env has been loaded
+func Load() error {
+	var l loader
+
+	// Emailed login codes
+	l.intRange("LOGIN_CODE_LENGTH", &LoginCodeLength, 4, 10)
+	l.duration("LOGIN_CODE_LIFETIME", &LoginCodeLifetime)
+	l.int("LOGIN_CODE_MAX_ATTEMPTS", &LoginCodeMaxAttempts, 1)
+	l.duration("LOGIN_CODE_RESEND_COOLDOWN", &LoginCodeResendCooldown)
+
+	// Brute-force protection
+	l.int("FAILURE_BACKOFF_THRESHOLD", &FailureBackoffThreshold, 1)
+	l.duration("FAILURE_BACKOFF_BASE", &FailureBackoffBase)
+	l.duration("FAILURE_BACKOFF_MAX", &FailureBackoffMax)
+	l.duration("FAILURE_WINDOW", &FailureWindow)
+	l.int("ACCOUNT_LOCKOUT_THRESHOLD", &AccountLockoutThreshold, 1)
+	l.int("IP_LOCKOUT_THRESHOLD", &IPLockoutThreshold, 1)
+	l.duration("LOCKOUT_DURATION", &LockoutDuration)
+
+	// Password reset
+	l.duration("PASSWORD_RESET_LIFETIME", &PasswordResetLifetime)
+	l.duration("PASSWORD_RESET_COOLDOWN", &PasswordResetCooldown)
+	l.int("PASSWORD_RESET_PER_IP", &PasswordResetPerIP, 1)
+	l.int("PASSWORD_RESET_SUBMITS_PER_IP", &PasswordResetSubmitsPerIP, 1)
+	l.duration("PASSWORD_RESET_IP_WINDOW", &PasswordResetIPWindow)
+
+	// Email verification and cleanup of abandoned accounts
+	l.duration("VERIFICATION_TOKEN_LIFETIME", &VerificationTokenLifetime)
+	l.duration("VERIFICATION_RESEND_COOLDOWN", &VerificationResendCooldown)
+	l.int("VERIFICATION_RESEND_PER_IP", &VerificationResendPerIP, 1)
+	l.duration("VERIFICATION_RESEND_IP_WINDOW", &VerificationResendIPWindow)
+	l.int("REGISTRATIONS_PER_IP", &RegistrationsPerIP, 1)
+	l.duration("REGISTRATION_IP_WINDOW", &RegistrationIPWindow)
+	l.duration("UNVERIFIED_ACCOUNT_RETENTION", &UnverifiedAccountRetention)
+	l.duration("EXPIRED_RECORD_PURGE_INTERVAL", &ExpiredRecordPurgeInterval)
+
+	// Passwordless sign-in
+	l.duration("MAGIC_LINK_LIFETIME", &MagicLinkLifetime)
+	l.duration("MAGIC_LINK_RESEND_COOLDOWN", &MagicLinkResendCooldown)
+	l.int("MAGIC_LINK_REQUESTS_PER_IP", &MagicLinkRequestsPerIP, 1)
+	l.duration("MAGIC_LINK_IP_WINDOW", &MagicLinkIPWindow)
+
+	// Argon2id parameters; Argon2 needs at least 8 KiB of memory per lane
+	l.intRange("ARGON2_PARALLELISM", &Argon2Parallelism, 1, math.MaxUint8)
+	l.intRange("ARGON2_MEMORY", &Argon2Memory, 8*Argon2Parallelism, math.MaxUint32)
+	l.intRange("ARGON2_ITERATIONS", &Argon2Iterations, 1, math.MaxUint32)
+	l.intRange("ARGON2_SALT_LENGTH", &Argon2SaltLength, 8, 64)
+	l.intRange("ARGON2_KEY_LENGTH", &Argon2KeyLength, 16, 64)
+
+	// Password hashing pool
+	l.int("HASH_POOL_WORKERS", &HashPoolWorkers, 0)
+	l.int("HASH_POOL_QUEUE_SIZE", &HashPoolQueueSize, 0)
+
+	return l.err
+}
+
+// Reads settings from the environment, keeping the first invalid value as the error
+type loader struct {
+	err error
+}
+
+func (l *loader) int(name string, value *int, min int) {
+	l.intRange(name, value, min, math.MaxInt)
+}
+
+func (l *loader) intRange(name string, value *int, min, max int) {
+	raw := os.Getenv(name)
+	if raw == "" || l.err != nil {
+		return
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < min || parsed > max {
+		l.err = fmt.Errorf("invalid %s %q", name, raw)
+		return
+	}
+	*value = parsed
+}
+
+// Durations use Go syntax, e.g. "90s" or "15m"
+func (l *loader) duration(name string, value *time.Duration) {
+	raw := os.Getenv(name)
+	if raw == "" || l.err != nil {
+		return
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil || parsed <= 0 {
+		l.err = fmt.Errorf("invalid %s %q", name, raw)
+		return
+	}
+	*value = parsed
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Put the login code settings back after a test overrides them
+func restoreLoginCode(t *testing.T) {
+	length, lifetime, attempts, cooldown := LoginCodeLength, LoginCodeLifetime, LoginCodeMaxAttempts, LoginCodeResendCooldown
+	t.Cleanup(func() {
+		LoginCodeLength, LoginCodeLifetime, LoginCodeMaxAttempts, LoginCodeResendCooldown = length, lifetime, attempts, cooldown
+	})
+}
+
+func TestLoadOverridesDefaults(t *testing.T) {
+	restoreLoginCode(t)
+	defaultAttempts := LoginCodeMaxAttempts
+	t.Setenv("LOGIN_CODE_LENGTH", "8")
+	t.Setenv("LOGIN_CODE_LIFETIME", "90s")
+
+	if err := Load(); err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	if LoginCodeLength != 8 || LoginCodeLifetime != 90*time.Second {
+		t.Errorf("LoginCodeLength, LoginCodeLifetime = %d, %v; want 8, 1m30s", LoginCodeLength, LoginCodeLifetime)
+	}
+	if LoginCodeMaxAttempts != defaultAttempts {
+		t.Errorf("LoginCodeMaxAttempts = %d, want the default %d when unset", LoginCodeMaxAttempts, defaultAttempts)
+	}
+}
+
+func TestLoadRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"LOGIN_CODE_LENGTH", "six"},
+		{"LOGIN_CODE_LENGTH", "3"},
+		{"LOGIN_CODE_LENGTH", "11"},
+		{"LOGIN_CODE_MAX_ATTEMPTS", "0"},
+		{"LOGIN_CODE_LIFETIME", "10"},
+		{"LOGIN_CODE_LIFETIME", "-1m"},
+		{"LOGIN_CODE_RESEND_COOLDOWN", "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			restoreLoginCode(t)
+			length, lifetime := LoginCodeLength, LoginCodeLifetime
+			t.Setenv(tt.name, tt.value)
+
+			err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.name) {
+				t.Errorf("Load error = %v, want one naming %s", err, tt.name)
+			}
+			if LoginCodeLength != length || LoginCodeLifetime != lifetime {
+				t.Error("an invalid value replaced a setting")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -9,6 +10,8 @@ import (
 	"sync"
 
 	"backendGo/auth"
+	"backendGo/secrets"
+	"backendGo/validation"
 
 	"github.com/brianvoe/gofakeit/v6"
 	_ "github.com/lib/pq"
@@ -41,8 +44,51 @@ func CreateTables(db *sql.DB) {
 		`CREATE TABLE IF NOT EXISTS accounts (acc_id BIGSERIAL PRIMARY KEY, username VARCHAR(50) NOT NULL, email VARCHAR(50) NOT NULL, encrypted_password TEXT NOT NULL, secretkey_2fa TEXT, is_email_verified BOOLEAN DEFAULT FALSE)`,
 		`CREATE TABLE IF NOT EXISTS characters (char_id BIGSERIAL PRIMARY KEY, acc_id BIGINT REFERENCES accounts(acc_id), class_id SMALLINT)`,
 		`CREATE TABLE IF NOT EXISTS scores (score_id BIGSERIAL PRIMARY KEY, char_id BIGINT REFERENCES characters(char_id), reward_score INT)`,
-		`CREATE TABLE IF NOT EXISTS sessions (session_id UUID PRIMARY KEY, acc_id BIGINT NOT NULL, metadata TEXT, expiry_datetime TIMESTAMPTZ NOT NULL, FOREIGN KEY (acc_id) REFERENCES accounts(acc_id))`,
+		`CREATE TABLE IF NOT EXISTS sessions (session_id UUID PRIMARY KEY, acc_id BIGINT NOT NULL, token_hash TEXT UNIQUE, ip_address TEXT, user_agent TEXT, created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, expiry_datetime TIMESTAMPTZ NOT NULL, FOREIGN KEY (acc_id) REFERENCES accounts(acc_id))`,
 		`CREATE TABLE IF NOT EXISTS email_verifications (id BIGSERIAL PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), verification_token UUID UNIQUE NOT NULL, secret_key_2fa TEXT NOT NULL, created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP)`,
+		// Upgrade sessions tables created before real session tokens were issued
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS token_hash TEXT UNIQUE`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip_address TEXT`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_acc_id ON sessions (acc_id)`,
+		// Authenticator app enrollment state
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS two_factor_method VARCHAR(10) NOT NULL DEFAULT 'email'`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS totp_last_step BIGINT`, // Last accepted authenticator time step, so codes cannot be replayed
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS recovery_codes TEXT[]`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP`,
+		// Email verifications also carry pending email changes, which have no 2FA secret
+		`ALTER TABLE email_verifications ADD COLUMN IF NOT EXISTS new_email VARCHAR(50)`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS username_key TEXT`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email_key TEXT`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'player' CHECK (role IN ('player', 'moderator', 'admin'))`,
+		`ALTER TABLE email_verifications ALTER COLUMN secret_key_2fa DROP NOT NULL`,
+		`CREATE TABLE IF NOT EXISTS one_time_codes (acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), purpose VARCHAR(20) NOT NULL, code_hash TEXT NOT NULL, attempts INT NOT NULL DEFAULT 0, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL, PRIMARY KEY (acc_id, purpose))`,
+		`CREATE TABLE IF NOT EXISTS password_resets (token_hash TEXT PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS auth_failures (scope VARCHAR(10) NOT NULL, key TEXT NOT NULL, failures INT NOT NULL DEFAULT 0, last_failure_at TIMESTAMPTZ NOT NULL, blocked_until TIMESTAMPTZ, locked_until TIMESTAMPTZ, unlock_token_hash TEXT, PRIMARY KEY (scope, key))`,
+		`CREATE TABLE IF NOT EXISTS email_outbox (id BIGSERIAL PRIMARY KEY, public_id UUID UNIQUE NOT NULL, recipient TEXT NOT NULL, subject TEXT NOT NULL, text_body TEXT NOT NULL, html_body TEXT, status VARCHAR(10) NOT NULL, attempts INT NOT NULL DEFAULT 0, last_error TEXT, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, next_attempt_at TIMESTAMPTZ NOT NULL, last_attempt_at TIMESTAMPTZ, sent_at TIMESTAMPTZ)`,
+		`CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON email_outbox (next_attempt_at) WHERE status = 'pending'`,
+		`CREATE TABLE IF NOT EXISTS login_challenges (challenge_hash TEXT PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), ip_address TEXT NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL, consumed_at TIMESTAMPTZ)`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS must_reset_password BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS known_devices (acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), ip_range TEXT NOT NULL, browser TEXT NOT NULL, os TEXT NOT NULL, first_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (acc_id, ip_range, browser, os))`,
+		`CREATE TABLE IF NOT EXISTS device_alerts (token_hash TEXT PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL)`,
+		`CREATE TABLE IF NOT EXISTS trusted_devices (device_id UUID PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), token_hash TEXT UNIQUE NOT NULL, label TEXT NOT NULL, ip_address TEXT, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, last_used_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS idx_trusted_devices_acc_id ON trusted_devices (acc_id)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (id BIGSERIAL PRIMARY KEY, event_type VARCHAR(40) NOT NULL, acc_id BIGINT, actor_id BIGINT, ip_address TEXT, user_agent TEXT, details JSONB, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_acc_id ON audit_events (acc_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (event_type, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at)`,
+		// The audit log is append-only; account IDs are kept without a foreign key so history survives account deletion
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$ BEGIN RAISE EXCEPTION 'audit_events is append-only'; END; $$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`,
+		`ALTER TABLE accounts ADD COLUMN IF NOT EXISTS magic_link_enabled BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS magic_links (token_hash TEXT PRIMARY KEY, acc_id BIGINT NOT NULL REFERENCES accounts(acc_id), created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at TIMESTAMPTZ NOT NULL)`,
+		`CREATE INDEX IF NOT EXISTS idx_magic_links_acc_id ON magic_links (acc_id)`,
 	}
 
 	for _, q := range queries {
@@ -92,12 +138,15 @@ func generateFakeData(db *sql.DB, start, count int) {
 
 	// Step 1: Generate fake data
 	for i := start; i < start+count; i++ {
-		username := gofakeit.Username()
-		email := gofakeit.Email()
+		username := validation.Normalize(gofakeit.Username())
+		email := validation.Normalize(gofakeit.Email())
 		password := gofakeit.Password(true, true, true, true, false, 12) // Random password
 
 		// Generate 2FA secret
-		secret, _, err := auth.Generate2FASecret()
+		secret, _, err := auth.Generate2FASecret(email)
+		if err == nil {
+			secret, err = secrets.Encrypt(secret)
+		}
 		if err != nil {
 			log.Printf("Error generating 2FA secret for account %s: %v", username, err)
 			continue
@@ -117,9 +166,14 @@ func generateFakeData(db *sql.DB, start, count int) {
 			Secret:   secret,
 		})
 
-		// Insert account (without hashing password yet)
+		// Insert account (without hashing password yet), skipping names or emails that are already taken
 		var accID uint64
-		err = db.QueryRow("INSERT INTO accounts (username, email, encrypted_password, secretkey_2fa, is_email_verified) VALUES ($1, $2, '', $3, TRUE) RETURNING acc_id", username, email, secret).Scan(&accID)
+		err = db.QueryRow("INSERT INTO accounts (username, email, username_key, email_key, encrypted_password, secretkey_2fa, is_email_verified) VALUES ($1, $2, $3, $4, '', $5, TRUE) ON CONFLICT DO NOTHING RETURNING acc_id",
+			username, email, validation.Key(username), validation.Key(email), secret).Scan(&accID)
+		if err == sql.ErrNoRows {
+			accounts = accounts[:len(accounts)-1]
+			continue
+		}
 		if err != nil {
 			log.Printf("Error creating account %s: %v", username, err)
 			continue
@@ -166,7 +220,7 @@ func hashPasswords(db *sql.DB, accounts []struct {
 	// Print statement indicating the start of password hashing process
 	fmt.Println("Starting password hashing process...")
 
-	// Determine the number of goroutines to use (adjust based on your needs)
+	// The shared hashing pool bounds how many hashes actually run; these goroutines only keep it fed
 	numGoroutines := 4
 	chunkSize := len(accounts) / numGoroutines
 
@@ -186,7 +240,7 @@ func hashPasswords(db *sql.DB, accounts []struct {
 			var values []string
 			for _, account := range accounts[start:end] {
 				// Hash the password
-				hashedPassword, err := auth.HashPassword(account.Password)
+				hashedPassword, err := auth.HashPassword(context.Background(), account.Password)
 				if err != nil {
 					log.Printf("Error hashing password for account %s: %v", account.Username, err)
 					continue
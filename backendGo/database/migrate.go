@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"backendGo/config"
+	"backendGo/validation"
+
+	"github.com/lib/pq"
+)
+
+// Backfill normalized username and email keys, report collisions and enforce uniqueness where possible
+func MigrateAccountKeys(db *sql.DB) {
+	if err := backfillAccountKeys(db); err != nil {
+		log.Fatalf("Failed to backfill account keys: %v", err)
+	}
+	_, err := db.Exec("ALTER TABLE accounts ALTER COLUMN username_key SET NOT NULL, ALTER COLUMN email_key SET NOT NULL")
+	if err != nil {
+		log.Fatalf("Failed to require account keys: %v", err)
+	}
+
+	for _, key := range []struct{ column, index string }{
+		{"username_key", config.UsernameKeyIndex},
+		{"email_key", config.EmailKeyIndex},
+	} {
+		collisions, err := reportCollisions(db, key.column)
+		if err != nil {
+			log.Fatalf("Failed to check %s collisions: %v", key.column, err)
+		}
+
+		// The index cannot be built over duplicates; resolve them by hand and restart
+		if collisions > 0 {
+			log.Printf("WARNING: %d %s values are shared by several accounts; %s was not created and uniqueness is not enforced", collisions, key.column, key.index)
+			continue
+		}
+
+		_, err = db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON accounts (%s)", key.index, key.column))
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", key.index, err)
+		}
+	}
+	fmt.Println("Account keys verified.")
+}
+
+// Fill in keys for accounts created before they existed
+func backfillAccountKeys(db *sql.DB) error {
+	rows, err := db.Query("SELECT acc_id, username, email FROM accounts WHERE username_key IS NULL OR email_key IS NULL")
+	if err != nil {
+		return err
+	}
+
+	type accountKeys struct {
+		accID                 uint64
+		usernameKey, emailKey string
+	}
+	var pending []accountKeys
+	for rows.Next() {
+		var accID uint64
+		var username, email string
+		if err := rows.Scan(&accID, &username, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, accountKeys{accID, validation.Key(username), validation.Key(email)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	fmt.Printf("Backfilling username and email keys for %d accounts...\n", len(pending))
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE accounts SET username_key = $1, email_key = $2 WHERE acc_id = $3")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, account := range pending {
+		if _, err := stmt.Exec(account.usernameKey, account.emailKey, account.accID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Log every key value held by more than one account, returning how many there are
+func reportCollisions(db *sql.DB, column string) (int, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, array_agg(acc_id ORDER BY acc_id) FROM accounts GROUP BY %s HAVING COUNT(*) > 1 ORDER BY %s", column, column, column))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	collisions := 0
+	for rows.Next() {
+		var key string
+		var accIDs pq.Int64Array
+		if err := rows.Scan(&key, &accIDs); err != nil {
+			return 0, err
+		}
+		log.Printf("Collision on %s %q: accounts %v", column, key, []int64(accIDs))
+		collisions++
+	}
+	return collisions, rows.Err()
+}
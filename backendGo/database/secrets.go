@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"backendGo/secrets"
+)
+
+// Columns holding encrypted values (2FA secrets and queued email bodies), with the key of their table
+var secretColumns = []struct{ table, idColumn, column string }{
+	{"accounts", "acc_id", "secretkey_2fa"},
+	{"accounts", "acc_id", "totp_pending_secret"},
+	{"email_verifications", "id", "secret_key_2fa"},
+	{"email_outbox", "id", "text_body"},
+	{"email_outbox", "id", "html_body"},
+}
+
+// Re-encrypt every stored secret that is plaintext or sealed with a retired key, returning how many were rewritten
+func ReencryptSecrets(db *sql.DB) (int, error) {
+	total := 0
+	for _, target := range secretColumns {
+		rewritten, err := reencryptColumn(db, target.table, target.idColumn, target.column)
+		if err != nil {
+			return total, fmt.Errorf("%s.%s: %w", target.table, target.column, err)
+		}
+		fmt.Printf("Re-encrypted %d values in %s.%s\n", rewritten, target.table, target.column)
+		total += rewritten
+	}
+	return total, nil
+}
+
+// Re-encrypt the values of one column under the active key
+func reencryptColumn(db *sql.DB, table, idColumn, column string) (int, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s <> ''", idColumn, column, table, column, column))
+	if err != nil {
+		return 0, err
+	}
+
+	type storedSecret struct {
+		id    uint64
+		value string
+	}
+	var stale []storedSecret
+	for rows.Next() {
+		var secret storedSecret
+		if err := rows.Scan(&secret.id, &secret.value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if secrets.NeedsReencrypt(secret.value) {
+			stale = append(stale, secret)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, secret := range stale {
+		plaintext, err := secrets.Decrypt(secret.value)
+		if err != nil {
+			return rewritten, fmt.Errorf("row %d: %w", secret.id, err)
+		}
+		sealed, err := secrets.Encrypt(plaintext)
+		if err != nil {
+			return rewritten, err
+		}
+
+		// Skip rows that changed since they were read
+		result, err := db.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2 AND %s = $3", table, column, idColumn, column), sealed, secret.id, secret.value)
+		if err != nil {
+			return rewritten, err
+		}
+		if updated, _ := result.RowsAffected(); updated > 0 {
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
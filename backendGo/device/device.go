@@ -0,0 +1,99 @@
+package device
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"backendGo/config"
+	"backendGo/session"
+	"backendGo/utils"
+)
+
+// ErrInvalidAlertToken is returned for unknown, expired or already-used "this wasn't me" tokens
+var ErrInvalidAlertToken = errors.New("invalid or expired alert token")
+
+// Fingerprint identifies a device coarsely enough to survive IP changes within a network and browser updates
+type Fingerprint struct {
+	IPRange string
+	Browser string
+	OS      string
+}
+
+// Build a fingerprint from a client IP and user agent
+func NewFingerprint(ipAddress, userAgent string) Fingerprint {
+	browser, os := session.ParseUserAgent(userAgent)
+	return Fingerprint{IPRange: IPRange(ipAddress), Browser: browser, OS: os}
+}
+
+// Reduce an IP address to its network (/24 for IPv4, /48 for IPv6) so address churn within a provider is not a new device
+func IPRange(ipAddress string) string {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return ipAddress
+	}
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return (&net.IPNet{IP: ipv4.Mask(net.CIDRMask(config.KnownDeviceIPv4Prefix, 32)), Mask: net.CIDRMask(config.KnownDeviceIPv4Prefix, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(config.KnownDeviceIPv6Prefix, 128)), Mask: net.CIDRMask(config.KnownDeviceIPv6Prefix, 128)}).String()
+}
+
+// Remember a device for the account, reporting whether it is new and whether the account had any known devices before
+func Remember(db *sql.DB, accountID uint64, fp Fingerprint) (isNew bool, hadDevices bool, err error) {
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM known_devices WHERE acc_id = $1)", accountID).Scan(&hadDevices)
+	if err != nil {
+		return false, false, err
+	}
+
+	// xmax is zero only for freshly inserted rows
+	err = db.QueryRow(`
+		INSERT INTO known_devices (acc_id, ip_range, browser, os) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (acc_id, ip_range, browser, os) DO UPDATE SET last_seen_at = NOW()
+		RETURNING xmax = 0`, accountID, fp.IPRange, fp.Browser, fp.OS).Scan(&isNew)
+	if err != nil {
+		return false, false, err
+	}
+	return isNew, hadDevices, nil
+}
+
+// Forget every known device of the account, so the next login from any of them is reported again
+func ForgetAll(db *sql.DB, accountID uint64) error {
+	_, err := db.Exec("DELETE FROM known_devices WHERE acc_id = $1", accountID)
+	return err
+}
+
+// Issue a "this wasn't me" token for a new-device notice
+func IssueAlertToken(db *sql.DB, accountID uint64) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("INSERT INTO device_alerts (token_hash, acc_id, expires_at) VALUES ($1, $2, $3)",
+		utils.HashToken(token), accountID, time.Now().Add(config.DeviceAlertLinkLifetime))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume a "this wasn't me" token, returning the account it was issued for
+func RedeemAlertToken(db *sql.DB, token string) (uint64, error) {
+	if token == "" {
+		return 0, ErrInvalidAlertToken
+	}
+
+	var accountID uint64
+	err := db.QueryRow("DELETE FROM device_alerts WHERE token_hash = $1 AND expires_at > NOW() RETURNING acc_id", utils.HashToken(token)).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidAlertToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// Every outstanding alert for the account has now been acted on
+	_, _ = db.Exec("DELETE FROM device_alerts WHERE acc_id = $1", accountID)
+	return accountID, nil
+}
@@ -0,0 +1,54 @@
+package device
+
+import "testing"
+
+func TestIPRange(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.42", "203.0.113.0/24"},
+		{"203.0.113.255", "203.0.113.0/24"},
+		{"203.0.114.1", "203.0.114.0/24"},
+		{"::ffff:203.0.113.42", "203.0.113.0/24"}, // IPv4-mapped IPv6 counts as IPv4
+		{"2001:db8:abcd:12::1", "2001:db8:abcd::/48"},
+		{"2001:db8:abcd:ffff:ffff::1", "2001:db8:abcd::/48"},
+		{"2001:db8:abce::1", "2001:db8:abce::/48"},
+		{"::1", "::/48"},
+		{"not an ip", "not an ip"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := IPRange(tt.ip); got != tt.want {
+			t.Errorf("IPRange(%q) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestNewFingerprint(t *testing.T) {
+	const chromeOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+	tests := []struct {
+		name      string
+		ip        string
+		userAgent string
+		want      Fingerprint
+	}{
+		{"desktop", "198.51.100.7", chromeOnWindows, Fingerprint{IPRange: "198.51.100.0/24", Browser: "Chrome", OS: "Windows"}},
+		{"unknown agent", "2001:db8::1", "curl/8.0", Fingerprint{IPRange: "2001:db8::/48", Browser: "Unknown", OS: "Unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewFingerprint(tt.ip, tt.userAgent); got != tt.want {
+				t.Errorf("NewFingerprint = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// A browser update or a new address in the same network is the same device
+	before := NewFingerprint("198.51.100.7", chromeOnWindows)
+	after := NewFingerprint("198.51.100.200", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36")
+	if before != after {
+		t.Errorf("fingerprints differ after a browser update: %+v vs %+v", before, after)
+	}
+}
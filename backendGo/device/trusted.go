@@ -0,0 +1,130 @@
+package device
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"backendGo/config"
+	"backendGo/models"
+	"backendGo/utils"
+
+	"github.com/google/uuid"
+)
+
+// Trust a browser to skip the second factor, returning the token to store in its cookie
+func Trust(db *sql.DB, accountID uint64, label, ipAddress string) (string, time.Time, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(config.TrustedDeviceLifetime)
+	_, err = db.Exec("INSERT INTO trusted_devices (device_id, acc_id, token_hash, label, ip_address, expires_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		uuid.New().String(), accountID, utils.HashToken(token), label, ipAddress, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Drop expired devices and the oldest ones beyond the per-account cap
+	_, err = db.Exec(`DELETE FROM trusted_devices WHERE acc_id = $1 AND (expires_at <= NOW() OR device_id IN (
+		SELECT device_id FROM trusted_devices WHERE acc_id = $1 ORDER BY created_at DESC OFFSET $2))`, accountID, config.MaxTrustedDevicesPerAcc)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Check a trusted-device token against the account, returning the device ID when it is valid
+func CheckTrusted(db *sql.DB, accountID uint64, token string) (string, bool, error) {
+	if token == "" {
+		return "", false, nil
+	}
+
+	var deviceID string
+	err := db.QueryRow("UPDATE trusted_devices SET last_used_at = NOW() WHERE token_hash = $1 AND acc_id = $2 AND expires_at > NOW() RETURNING device_id",
+		utils.HashToken(token), accountID).Scan(&deviceID)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return deviceID, true, nil
+}
+
+// List the account's unexpired trusted devices, most recently used first, marking the one holding currentToken
+func ListTrusted(db *sql.DB, accountID uint64, currentToken string) ([]models.TrustedDevice, error) {
+	rows, err := db.Query(`
+		SELECT device_id, label, COALESCE(ip_address, ''), created_at, last_used_at, expires_at, token_hash = $2
+		FROM trusted_devices
+		WHERE acc_id = $1 AND expires_at > NOW()
+		ORDER BY last_used_at DESC`, accountID, utils.HashToken(currentToken))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []models.TrustedDevice{}
+	for rows.Next() {
+		var d models.TrustedDevice
+		if err := rows.Scan(&d.DeviceID, &d.Label, &d.IPAddress, &d.CreatedAt, &d.LastUsedAt, &d.ExpiresAt, &d.Current); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// Revoke one of the account's trusted devices, reporting whether it existed
+func RevokeTrusted(db *sql.DB, accountID uint64, deviceID string) (bool, error) {
+	result, err := db.Exec("DELETE FROM trusted_devices WHERE device_id = $1 AND acc_id = $2", deviceID, accountID)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := result.RowsAffected()
+	return revoked > 0, err
+}
+
+// Revoke every trusted device of the account, returning how many there were
+func RevokeAllTrusted(db *sql.DB, accountID uint64) (int64, error) {
+	result, err := db.Exec("DELETE FROM trusted_devices WHERE acc_id = $1", accountID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Extract the trusted-device token from its cookie
+func TrustedTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(config.TrustedDeviceCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Set the trusted-device cookie on the response
+func SetTrustedCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.TrustedDeviceCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Clear the trusted-device cookie on the response
+func ClearTrustedCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.TrustedDeviceCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
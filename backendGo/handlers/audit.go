@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backendGo/audit"
+	"backendGo/utils"
+)
+
+// Audit log handler (filters: accID, type, from, to as RFC 3339)
+func AuditEventsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	query := r.URL.Query()
+
+	page, limit, err := utils.ValidatePaginationParams(query.Get("page"), query.Get("limit"))
+	if err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	filter := audit.Filter{EventType: query.Get("type"), Page: page, Limit: limit}
+
+	if accIDStr := query.Get("accID"); accIDStr != "" {
+		filter.AccID, err = strconv.ParseUint(accIDStr, 10, 64)
+		if err != nil {
+			utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid 'accID' parameter: must be a positive integer"})
+			return
+		}
+	}
+	for _, bound := range []struct {
+		name   string
+		target *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		*bound.target, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid '%s' parameter: must be an RFC 3339 timestamp", bound.name)})
+			return
+		}
+	}
+
+	events, total, err := audit.Query(db, filter)
+	if err != nil {
+		fmt.Println("Error querying audit events:", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch audit events"})
+		return
+	}
+
+	totalPages := (total + limit - 1) / limit
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"data":            events,
+		"total":           total,
+		"totalPages":      totalPages,
+		"currentPage":     page,
+		"hasNextPage":     page < totalPages,
+		"hasPreviousPage": page > 1,
+	})
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"backendGo/outbox"
+	"backendGo/utils"
+
+	"github.com/google/uuid"
+)
+
+// Email status handler
+func EmailStatusHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		utils.WriteJSONResponse(w, http.StatusBadRequest, map[string]string{"error": "Invalid email ID"})
+		return
+	}
+
+	status, err := outbox.Status(db, id)
+	if err == outbox.ErrNotFound {
+		utils.WriteJSONResponse(w, http.StatusNotFound, map[string]string{"error": "Email not found"})
+		return
+	}
+	if err != nil {
+		fmt.Println("Error fetching email status:", err)
+		utils.WriteJSONResponse(w, http.StatusInternalServerError, map[string]string{"error": "Failed to fetch email status"})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, status)
+}
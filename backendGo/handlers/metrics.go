@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backendGo/passhash"
+	"backendGo/utils"
+)
+
+// Password hashing pool metrics handler
+func HashingMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSONResponse(w, http.StatusOK, passhash.Workers.Stats())
+}
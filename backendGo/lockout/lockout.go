@@ -0,0 +1,146 @@
+package lockout
+
+import (
+	"database/sql"
+	"time"
+
+	"backendGo/config"
+	"backendGo/utils"
+	"backendGo/validation"
+)
+
+// Scopes failures are counted under
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Block describes why attempts are being refused and for how long
+type Block struct {
+	Locked     bool          // True for a lockout, false for exponential backoff
+	RetryAfter time.Duration // Time until the next attempt is allowed
+}
+
+// Normalize an account key so that failures count against the same row regardless of case or Unicode form
+func AccountKey(username string) string {
+	return validation.Key(username)
+}
+
+// Number of failures after which the scope is locked out
+func lockoutThreshold(scope string) int {
+	if scope == ScopeIP {
+		return config.IPLockoutThreshold
+	}
+	return config.AccountLockoutThreshold
+}
+
+// Report whether the given number of consecutive failures locks the scope out
+func lockedOut(scope string, failures int) bool {
+	return failures >= lockoutThreshold(scope)
+}
+
+// Delay before the next attempt after the given number of consecutive failures
+func backoff(failures int) time.Duration {
+	if failures < config.FailureBackoffThreshold {
+		return 0
+	}
+	delay := config.FailureBackoffBase
+	for i := config.FailureBackoffThreshold; i < failures && delay < config.FailureBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > config.FailureBackoffMax {
+		delay = config.FailureBackoffMax
+	}
+	return delay
+}
+
+// Check whether attempts for the key are currently refused, returning nil when they are allowed
+func Check(db *sql.DB, scope, key string) (*Block, error) {
+	var blockedUntil, lockedUntil sql.NullTime
+	err := db.QueryRow("SELECT blocked_until, locked_until FROM auth_failures WHERE scope = $1 AND key = $2", scope, key).Scan(&blockedUntil, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return blockAt(blockedUntil, lockedUntil, time.Now()), nil
+}
+
+// Decide whether a key with the given backoff and lockout deadlines is blocked at the given time; a lockout takes precedence
+func blockAt(blockedUntil, lockedUntil sql.NullTime, now time.Time) *Block {
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return &Block{Locked: true, RetryAfter: lockedUntil.Time.Sub(now)}
+	}
+	if blockedUntil.Valid && blockedUntil.Time.After(now) {
+		return &Block{RetryAfter: blockedUntil.Time.Sub(now)}
+	}
+	return nil
+}
+
+// Record a failed attempt, reporting whether it just pushed the key into lockout
+func RecordFailure(db *sql.DB, scope, key string) (bool, error) {
+	// Counters start over once the key has been quiet for the failure window or a lockout has run out
+	var failures int
+	err := db.QueryRow(`
+		INSERT INTO auth_failures (scope, key, failures, last_failure_at) VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE SET
+			failures = CASE
+				WHEN auth_failures.last_failure_at < NOW() - $3 * INTERVAL '1 second' OR auth_failures.locked_until <= NOW() THEN 1
+				ELSE auth_failures.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures`, scope, key, int(config.FailureWindow.Seconds())).Scan(&failures)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	blockedUntil := now.Add(backoff(failures))
+	if lockedOut(scope, failures) {
+		_, err = db.Exec("UPDATE auth_failures SET blocked_until = $1, locked_until = $2 WHERE scope = $3 AND key = $4",
+			blockedUntil, now.Add(config.LockoutDuration), scope, key)
+	} else {
+		_, err = db.Exec("UPDATE auth_failures SET blocked_until = $1 WHERE scope = $2 AND key = $3", blockedUntil, scope, key)
+	}
+	return failures == lockoutThreshold(scope), err
+}
+
+// Clear the failure counter for the key after a successful attempt
+func Reset(db *sql.DB, scope, key string) error {
+	_, err := db.Exec("DELETE FROM auth_failures WHERE scope = $1 AND key = $2", scope, key)
+	return err
+}
+
+// Issue an emailed unlock token for a locked-out account key
+func IssueUnlockToken(db *sql.DB, key string) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec("UPDATE auth_failures SET unlock_token_hash = $1 WHERE scope = $2 AND key = $3", utils.HashToken(token), ScopeAccount, key)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Lift an account lockout using an unlock token, reporting whether the token was valid
+func Unlock(db *sql.DB, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	result, err := db.Exec("DELETE FROM auth_failures WHERE scope = $1 AND unlock_token_hash = $2 AND locked_until > NOW()", ScopeAccount, utils.HashToken(token))
+	if err != nil {
+		return false, err
+	}
+
+	unlocked, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return unlocked > 0, nil
+}
@@ -0,0 +1,105 @@
+package lockout
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"backendGo/config"
+)
+
+func TestBackoff(t *testing.T) {
+	threshold := config.FailureBackoffThreshold
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", 0, 0},
+		{"below threshold", threshold - 1, 0},
+		{"at threshold", threshold, config.FailureBackoffBase},
+		{"one above threshold", threshold + 1, 2 * config.FailureBackoffBase},
+		{"two above threshold", threshold + 2, 4 * config.FailureBackoffBase},
+		{"just below the cap", threshold + 8, 256 * config.FailureBackoffBase},
+		{"reaches the cap", threshold + 9, config.FailureBackoffMax},
+		{"far above the cap", threshold + 1000, config.FailureBackoffMax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(tt.failures); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockedOut(t *testing.T) {
+	tests := []struct {
+		scope     string
+		threshold int
+	}{
+		{ScopeAccount, config.AccountLockoutThreshold},
+		{ScopeIP, config.IPLockoutThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			for _, c := range []struct {
+				failures int
+				want     bool
+			}{
+				{0, false},
+				{tt.threshold - 1, false},
+				{tt.threshold, true},
+				{tt.threshold + 1, true},
+			} {
+				if got := lockedOut(tt.scope, c.failures); got != c.want {
+					t.Errorf("lockedOut(%q, %d) = %v, want %v", tt.scope, c.failures, got, c.want)
+				}
+			}
+		})
+	}
+
+	// A shared address must be able to fail far more often than a single account before it is locked out
+	if lockedOut(ScopeIP, config.AccountLockoutThreshold) {
+		t.Error("an IP is locked out after as few failures as an account")
+	}
+}
+
+func TestBlockAt(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(offset time.Duration) sql.NullTime { return sql.NullTime{Time: now.Add(offset), Valid: true} }
+	none := sql.NullTime{}
+
+	tests := []struct {
+		name         string
+		blockedUntil sql.NullTime
+		lockedUntil  sql.NullTime
+		want         *Block
+	}{
+		{"never failed", none, none, nil},
+		{"backoff running", at(30 * time.Second), none, &Block{RetryAfter: 30 * time.Second}},
+		{"backoff over", at(-time.Second), none, nil},
+		{"backoff ends now", at(0), none, nil},
+		{"locked", at(time.Second), at(10 * time.Minute), &Block{Locked: true, RetryAfter: 10 * time.Minute}},
+		{"lockout outlasts backoff", at(-time.Minute), at(time.Minute), &Block{Locked: true, RetryAfter: time.Minute}},
+		{"lockout over, backoff running", at(5 * time.Second), at(-time.Minute), &Block{RetryAfter: 5 * time.Second}},
+		{"both over", at(-time.Minute), at(-time.Second), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := blockAt(tt.blockedUntil, tt.lockedUntil, now)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("blockAt = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountKey(t *testing.T) {
+	// Failures must count against one row however the username is typed
+	for _, username := range []string{"bobsmith", "BobSmith", " BOBSMITH ", "ｂｏｂｓｍｉｔｈ"} {
+		if got := AccountKey(username); got != "bobsmith" {
+			t.Errorf("AccountKey(%q) = %q, want %q", username, got, "bobsmith")
+		}
+	}
+}
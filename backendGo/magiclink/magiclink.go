@@ -0,0 +1,94 @@
+package magiclink
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"backendGo/config"
+	"backendGo/utils"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or already-used sign-in links
+	ErrInvalidToken = errors.New("invalid or expired sign-in link")
+	// ErrSentTooSoon is returned when the account was sent a link within the cooldown
+	ErrSentTooSoon = errors.New("sign-in link was sent too recently")
+)
+
+// Issue a sign-in token for the account, replacing any earlier unused one, unless one was issued within the cooldown
+func Issue(db *sql.DB, accountID uint64) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	err = tx.QueryRow("SELECT created_at FROM magic_links WHERE acc_id = $1 AND expires_at > NOW() ORDER BY created_at DESC LIMIT 1 FOR UPDATE", accountID).Scan(&createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if err == nil && time.Since(createdAt) < config.MagicLinkResendCooldown {
+		return "", ErrSentTooSoon
+	}
+
+	if _, err := tx.Exec("DELETE FROM magic_links WHERE acc_id = $1", accountID); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO magic_links (token_hash, acc_id, expires_at) VALUES ($1, $2, $3)",
+		utils.HashToken(token), accountID, time.Now().Add(config.MagicLinkLifetime))
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Find the account a live sign-in token was issued for without using it up
+func Lookup(db *sql.DB, token string) (uint64, error) {
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	var accountID uint64
+	err := db.QueryRow("SELECT acc_id FROM magic_links WHERE token_hash = $1 AND expires_at > NOW()", utils.HashToken(token)).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
+
+// Consume a sign-in token, returning the account it was issued for
+func Redeem(db *sql.DB, token string) (uint64, error) {
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	var accountID uint64
+	err := db.QueryRow("DELETE FROM magic_links WHERE token_hash = $1 AND expires_at > NOW() RETURNING acc_id", utils.HashToken(token)).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
+
+// Invalidate every outstanding sign-in link of the account
+func RevokeAll(db *sql.DB, accountID uint64) error {
+	_, err := db.Exec("DELETE FROM magic_links WHERE acc_id = $1", accountID)
+	return err
+}
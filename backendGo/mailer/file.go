@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes each message to a .eml file in a directory, for local development
+type FileMailer struct {
+	dir     string
+	from    string
+	counter atomic.Uint64
+}
+
+// Create a file mailer, making sure the directory exists
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %v", err)
+	}
+	if from == "" {
+		from = "noreply@localhost"
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Write the message to a new .eml file
+func (m *FileMailer) Send(msg Message) error {
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%d-%s.eml", time.Now().Format("20060102T150405.000000000"), m.counter.Add(1), recipient)
+	return os.WriteFile(filepath.Join(m.dir, name), msg.Bytes(m.from), 0o644)
+}
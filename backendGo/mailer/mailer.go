@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a single outgoing email with a plain text body and an optional HTML alternative
+type Message struct {
+	To       string
+	Subject  string
+	Body     string
+	HTMLBody string
+}
+
+// Mailer delivers outgoing email
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Queue is a Mailer that stores messages for later delivery and returns an ID to track them by
+type Queue interface {
+	Mailer
+	Enqueue(msg Message) (string, error)
+}
+
+// Strip line breaks so header values cannot inject extra headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// Generate a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// Write a body part encoded as quoted-printable
+func writeQuotedPrintable(b *strings.Builder, contentType, body string) {
+	fmt.Fprintf(b, "Content-Type: %s; charset=UTF-8\r\n", contentType)
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(b)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+	b.WriteString("\r\n")
+}
+
+// Render the message as raw RFC 5322 bytes from the given sender
+func (m Message) Bytes(from string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(m.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: %s\r\n", messageID(from))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTMLBody == "" {
+		writeQuotedPrintable(&b, "text/plain", m.Body)
+		return []byte(b.String())
+	}
+
+	boundary := strings.TrimSuffix(strings.TrimPrefix(messageID(from), "<"), ">")
+	boundary = strings.NewReplacer("@", "_", ".", "_").Replace(boundary)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	writeQuotedPrintable(&b, "text/plain", m.Body)
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	writeQuotedPrintable(&b, "text/html", m.HTMLBody)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return []byte(b.String())
+}
+
+// Build the mailer selected by MAIL_DRIVER ("smtp" by default, "file" or "memory")
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("SMTP_FROM")
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "smtp":
+		username := os.Getenv("SMTP_USERNAME")
+		if username == "" {
+			username = from
+		}
+		tlsMode := os.Getenv("SMTP_TLS_MODE")
+		if tlsMode == "" {
+			tlsMode = TLSModeStartTLS
+		}
+		timeout := DefaultSMTPTimeout
+		if value := os.Getenv("SMTP_TIMEOUT"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid SMTP_TIMEOUT %q", value)
+			}
+			timeout = parsed
+		}
+		return NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_SERVER"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: username,
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+			TLSMode:  tlsMode,
+			Timeout:  timeout,
+		})
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		return NewFileMailer(dir, from)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer()
+	first := Message{To: "a@example.com", Subject: "First"}
+	second := Message{To: "b@example.com", Subject: "Second"}
+
+	for _, msg := range []Message{first, second} {
+		if err := m.Send(msg); err != nil {
+			t.Fatalf("Send(%q) returned %v", msg.Subject, err)
+		}
+	}
+
+	got := m.Messages()
+	if len(got) != 2 || got[0] != first || got[1] != second {
+		t.Fatalf("Messages() = %+v, want [%+v %+v]", got, first, second)
+	}
+
+	// The returned slice is a copy
+	got[0].Subject = "Changed"
+	if m.Messages()[0].Subject != "First" {
+		t.Error("modifying the result of Messages() changed the stored message")
+	}
+
+	m.Reset()
+	if n := len(m.Messages()); n != 0 {
+		t.Errorf("Messages() after Reset() has %d messages, want 0", n)
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       Message
+		multipart bool
+	}{
+		{"plain text", Message{To: "player@example.com", Subject: "Your code", Body: "Code: 123456\nBye"}, false},
+		{"with HTML", Message{To: "player@example.com", Subject: "Your code", Body: "Code: 123456", HTMLBody: "<p>Code: 123456</p>"}, true},
+		{"non-ASCII subject", Message{To: "player@example.com", Subject: "Grüße", Body: "Hallo"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := mail.ReadMessage(strings.NewReader(string(tt.msg.Bytes("Kai <noreply@kai.example>"))))
+			if err != nil {
+				t.Fatalf("output is not a valid message: %v", err)
+			}
+
+			if got := parsed.Header.Get("To"); got != tt.msg.To {
+				t.Errorf("To = %q, want %q", got, tt.msg.To)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+			if err != nil || subject != tt.msg.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.msg.Subject)
+			}
+			if id := parsed.Header.Get("Message-ID"); !strings.HasSuffix(id, "@kai.example>") {
+				t.Errorf("Message-ID = %q, want one in the sender's domain", id)
+			}
+
+			mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("bad Content-Type: %v", err)
+			}
+			if !tt.multipart {
+				if mediaType != "text/plain" {
+					t.Fatalf("Content-Type = %q, want text/plain", mediaType)
+				}
+				body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+				if want := strings.ReplaceAll(tt.msg.Body, "\n", "\r\n"); strings.TrimSuffix(string(body), "\r\n") != want {
+					t.Errorf("body = %q, want %q", body, want)
+				}
+				return
+			}
+
+			if mediaType != "multipart/alternative" {
+				t.Fatalf("Content-Type = %q, want multipart/alternative", mediaType)
+			}
+			reader := multipart.NewReader(parsed.Body, params["boundary"])
+			var parts []string
+			for {
+				part, err := reader.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("reading part: %v", err)
+				}
+				body, _ := io.ReadAll(part)
+				parts = append(parts, strings.TrimSuffix(string(body), "\r\n"))
+			}
+			if len(parts) != 2 || parts[0] != tt.msg.Body || parts[1] != tt.msg.HTMLBody {
+				t.Errorf("parts = %q, want [%q %q]", parts, tt.msg.Body, tt.msg.HTMLBody)
+			}
+		})
+	}
+}
+
+func TestMessageBytesStripsHeaderInjection(t *testing.T) {
+	msg := Message{To: "player@example.com\r\nBcc: victim@example.com", Subject: "Hi\nBcc: victim@example.com", Body: "Hello"}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg.Bytes("noreply@kai.example"))))
+	if err != nil {
+		t.Fatalf("output is not a valid message: %v", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("injected Bcc header %q", bcc)
+	}
+}
@@ -0,0 +1,112 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// TLS modes for SMTP connections
+const (
+	TLSModeStartTLS = "starttls" // Upgrade a plain connection with STARTTLS (usually port 587)
+	TLSModeImplicit = "tls"      // Connect over TLS from the start (usually port 465)
+	TLSModeNone     = "none"     // No encryption, only suitable for a local relay
+)
+
+// DefaultSMTPTimeout bounds a whole delivery so an unresponsive server cannot stall the outbox worker
+const DefaultSMTPTimeout = 30 * time.Second
+
+// SMTPConfig holds the connection settings for an SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	TLSMode  string
+	Timeout  time.Duration // Deadline for connecting and the whole exchange; zero means DefaultSMTPTimeout
+}
+
+// SMTPMailer delivers email through an SMTP server
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+// Create an SMTP mailer, validating its configuration
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Host == "" || config.Port == "" || config.From == "" {
+		return nil, fmt.Errorf("SMTP_SERVER, SMTP_PORT and SMTP_FROM must be set")
+	}
+	switch config.TLSMode {
+	case TLSModeStartTLS, TLSModeImplicit, TLSModeNone:
+	default:
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q", config.TLSMode)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultSMTPTimeout
+	}
+	return &SMTPMailer{config: config}, nil
+}
+
+// Send the message over a new SMTP connection
+func (m *SMTPMailer) Send(msg Message) error {
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+	tlsConfig := &tls.Config{ServerName: m.config.Host}
+
+	// Every read and write after connecting shares one deadline, so a stalled server fails the attempt instead of hanging
+	dialer := &net.Dialer{Timeout: m.config.Timeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(m.config.Timeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	if m.config.TLSMode == TLSModeImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error connecting to SMTP server: %v", err)
+	}
+	defer client.Close()
+
+	if m.config.TLSMode == TLSModeStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("error starting TLS: %v", err)
+		}
+	}
+
+	if m.config.Password != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("error authenticating with SMTP server: %v", err)
+		}
+	}
+
+	if err := client.Mail(m.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(m.config.From)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,113 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Built-in templates, used for any file missing from the override directory
+//
+//go:embed templates/*
+var embeddedTemplates embed.FS
+
+// Template names for transactional emails
+const (
+	TemplateVerifyEmail       = "verify_email"
+	TemplateLoginCode         = "login_code"
+	TemplatePasswordReset     = "password_reset"
+	TemplateAccountLocked     = "account_locked"
+	TemplateEmailChangeNotice = "email_change_notice"
+	TemplatePasswordChanged   = "password_changed"
+	TemplateNewDeviceLogin    = "new_device_login"
+	TemplateAccountExists     = "account_exists"
+	TemplateUsernameTaken     = "username_taken"
+	TemplateMagicLink         = "magic_link"
+)
+
+// Renderer builds messages from a text template and an HTML template per email
+type Renderer struct {
+	overrideDir string
+	appName     string
+}
+
+// Create a renderer that prefers templates in overrideDir (when set) over the built-in ones
+func NewRenderer(overrideDir, appName string) *Renderer {
+	return &Renderer{overrideDir: overrideDir, appName: appName}
+}
+
+// Read a template file, checking the override directory first so templates can change without a rebuild
+func (r *Renderer) readFile(name string) (string, error) {
+	if r.overrideDir != "" {
+		content, err := os.ReadFile(filepath.Join(r.overrideDir, name))
+		if err == nil {
+			return string(content), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	content, err := embeddedTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Render the named template for a recipient; data is merged with the common AppName field
+func (r *Renderer) Render(name, to string, data map[string]interface{}) (Message, error) {
+	values := map[string]interface{}{"AppName": r.appName}
+	for k, v := range data {
+		values[k] = v
+	}
+
+	textSource, err := r.readFile(name + ".txt")
+	if err != nil {
+		return Message{}, err
+	}
+	textTmpl, err := texttemplate.New(name + ".txt").Parse(textSource)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, textBody bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", values); err != nil {
+		return Message{}, err
+	}
+	if err := textTmpl.Execute(&textBody, values); err != nil {
+		return Message{}, err
+	}
+
+	layoutSource, err := r.readFile("layout.html")
+	if err != nil {
+		return Message{}, err
+	}
+	htmlSource, err := r.readFile(name + ".html")
+	if err != nil {
+		return Message{}, err
+	}
+	htmlTmpl, err := htmltemplate.New("layout.html").Parse(layoutSource)
+	if err != nil {
+		return Message{}, err
+	}
+	if _, err := htmlTmpl.New(name + ".html").Parse(htmlSource); err != nil {
+		return Message{}, err
+	}
+
+	var htmlBody bytes.Buffer
+	if err := htmlTmpl.ExecuteTemplate(&htmlBody, "layout.html", values); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:       to,
+		Subject:  strings.TrimSpace(subject.String()),
+		Body:     textBody.String(),
+		HTMLBody: htmlBody.String(),
+	}, nil
+}
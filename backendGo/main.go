@@ -8,14 +8,39 @@ import (
 
 	"backendGo/auth"
 	"backendGo/cache"
+	"backendGo/config"
 	"backendGo/database"
 	"backendGo/handlers"
+	"backendGo/mailer"
+	"backendGo/maintenance"
+	"backendGo/outbox"
+	"backendGo/passhash"
+	"backendGo/roles"
+	"backendGo/secrets"
+	"backendGo/session"
 	"backendGo/utils"
 
+	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
 
 func main() {
+	// Load environment variables from .env when present
+	if err := godotenv.Load("./.env"); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+
+	// Override the tunable settings from the environment
+	if err := config.Load(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	passhash.Configure()
+
+	// Load the keys that encrypt 2FA secrets at rest
+	if err := secrets.LoadFromEnv(); err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+
 	// Initialize the cache
 	cache.InitializeCache()
 
@@ -25,10 +50,29 @@ func main() {
 
 	// Create tables if needed
 	database.CreateTables(db)
+	database.MigrateAccountKeys(db)
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		runCommand(db, os.Args[1], os.Args[2:])
+		return
+	}
+
+	// Set up outgoing email, queued in the database and delivered in the background
+	transport, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+	emailQueue := outbox.New(db, transport)
+	emailQueue.Start()
+	authMail := auth.NewMail(emailQueue, mailer.NewRenderer(os.Getenv("MAIL_TEMPLATE_DIR"), config.AppName))
 
 	// Populate the database with fake data if it is empty
 	database.GenerateDataIfNeeded(db)
 
+	// Purge expired tokens and abandoned unverified accounts in the background
+	maintenance.StartPurgeLoop(db)
+
 	// Set up HTTP routes
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
@@ -39,17 +83,98 @@ func main() {
 		handlers.PaginatedHandler(w, r, db)
 	})
 	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		auth.LoginHandler(w, r, db)
+		auth.LoginHandler(w, r, db, authMail)
 	})
 	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		auth.RegisterHandler(w, r, db)
+		auth.RegisterHandler(w, r, db, authMail)
 	})
 	http.HandleFunc("/verify-email", func(w http.ResponseWriter, r *http.Request) {
 		auth.VerifyEmailHandler(w, r, db)
 	})
 	http.HandleFunc("/verify-2fa", func(w http.ResponseWriter, r *http.Request) {
-		auth.Verify2FAHandler(w, r, db)
+		auth.Verify2FAHandler(w, r, db, authMail)
+	})
+	http.HandleFunc("POST /verify-email/resend", func(w http.ResponseWriter, r *http.Request) {
+		auth.ResendVerificationHandler(w, r, db, authMail)
+	})
+	http.HandleFunc("POST /password/forgot", func(w http.ResponseWriter, r *http.Request) {
+		auth.ForgotPasswordHandler(w, r, db, authMail)
+	})
+	http.HandleFunc("POST /password/reset", func(w http.ResponseWriter, r *http.Request) {
+		auth.ResetPasswordHandler(w, r, db)
+	})
+	http.HandleFunc("GET /emails/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.EmailStatusHandler(w, r, db)
+	})
+	http.HandleFunc("GET /unlock", func(w http.ResponseWriter, r *http.Request) {
+		auth.UnlockAccountHandler(w, r, db)
+	})
+	http.HandleFunc("GET /security/not-me", auth.NotMePageHandler)
+	http.HandleFunc("POST /security/not-me", func(w http.ResponseWriter, r *http.Request) {
+		auth.NotMeHandler(w, r, db)
+	})
+	http.HandleFunc("POST /verify-2fa/resend", func(w http.ResponseWriter, r *http.Request) {
+		auth.Resend2FACodeHandler(w, r, db, authMail)
+	})
+	http.HandleFunc("POST /login/magic", func(w http.ResponseWriter, r *http.Request) {
+		auth.MagicLinkRequestHandler(w, r, db, authMail)
+	})
+	http.HandleFunc("POST /login/magic/verify", func(w http.ResponseWriter, r *http.Request) {
+		auth.MagicLinkLoginHandler(w, r, db, authMail)
 	})
+	http.HandleFunc("GET /me", session.RequireAuth(db, auth.MeHandler))
+	http.HandleFunc("POST /logout", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.LogoutHandler(w, r, db)
+	}))
+	http.HandleFunc("POST /account/password", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.ChangePasswordHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("POST /account/email", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.ChangeEmailHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("POST /2fa/totp/enroll", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.TOTPEnrollHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("POST /2fa/totp/confirm", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.TOTPConfirmHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("POST /account/magic-link", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.MagicLinkSettingHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("POST /2fa/method", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.TwoFactorMethodHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("GET /2fa/recovery-codes", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RecoveryCodesStatusHandler(w, r, db)
+	}))
+	http.HandleFunc("POST /2fa/recovery-codes", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RegenerateRecoveryCodesHandler(w, r, db, authMail)
+	}))
+	http.HandleFunc("GET /metrics/hashing", session.RequirePermission(db, roles.ViewMetrics, handlers.HashingMetricsHandler))
+	http.HandleFunc("PUT /admin/accounts/{id}/role", session.RequirePermission(db, roles.ManageRoles, func(w http.ResponseWriter, r *http.Request) {
+		auth.SetRoleHandler(w, r, db)
+	}))
+	http.HandleFunc("GET /admin/audit-events", session.RequirePermission(db, roles.ViewAudit, func(w http.ResponseWriter, r *http.Request) {
+		handlers.AuditEventsHandler(w, r, db)
+	}))
+	http.HandleFunc("GET /trusted-devices", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.ListTrustedDevicesHandler(w, r, db)
+	}))
+	http.HandleFunc("DELETE /trusted-devices", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RevokeAllTrustedDevicesHandler(w, r, db)
+	}))
+	http.HandleFunc("DELETE /trusted-devices/{id}", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RevokeTrustedDeviceHandler(w, r, db)
+	}))
+	http.HandleFunc("GET /sessions", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.ListSessionsHandler(w, r, db)
+	}))
+	http.HandleFunc("DELETE /sessions", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RevokeAllSessionsHandler(w, r, db)
+	}))
+	http.HandleFunc("DELETE /sessions/{id}", session.RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		auth.RevokeSessionHandler(w, r, db)
+	}))
 
 	// Set up CORS
 	corsHandler := cors.New(cors.Options{
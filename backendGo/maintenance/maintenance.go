@@ -0,0 +1,86 @@
+package maintenance
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"backendGo/config"
+)
+
+// Periodically purge expired tokens and abandoned unverified accounts
+func StartPurgeLoop(db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(config.ExpiredRecordPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			PurgeExpiredRecords(db)
+			<-ticker.C
+		}
+	}()
+}
+
+// Delete expired tokens and unverified accounts past their retention period
+func PurgeExpiredRecords(db *sql.DB) {
+	verificationTTL := int(config.VerificationTokenLifetime.Seconds())
+	retention := int(config.UnverifiedAccountRetention.Seconds())
+
+	purges := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		// Registration rows hold the pending 2FA secret and are needed to resend the link, so they live until the account is verified or abandoned
+		{"expired email change verifications", "DELETE FROM email_verifications WHERE new_email IS NOT NULL AND created_at < NOW() - $1 * INTERVAL '1 second'", []interface{}{verificationTTL}},
+		{"expired login codes", "DELETE FROM one_time_codes WHERE expires_at < NOW()", nil},
+		{"expired login challenges", "DELETE FROM login_challenges WHERE expires_at < NOW() OR consumed_at IS NOT NULL", nil},
+		{"expired password resets", "DELETE FROM password_resets WHERE expires_at < NOW()", nil},
+		{"expired device alerts", "DELETE FROM device_alerts WHERE expires_at < NOW()", nil},
+		{"expired trusted devices", "DELETE FROM trusted_devices WHERE expires_at < NOW()", nil},
+		{"expired sign-in links", "DELETE FROM magic_links WHERE expires_at < NOW()", nil},
+		{"delivered outbox emails", "DELETE FROM email_outbox WHERE status = 'sent' AND sent_at < NOW() - $1 * INTERVAL '1 second'", []interface{}{int(config.OutboxRetention.Seconds())}},
+		{"dead-lettered outbox emails", "DELETE FROM email_outbox WHERE status = 'dead' AND last_attempt_at < NOW() - $1 * INTERVAL '1 second'", []interface{}{int(config.OutboxRetention.Seconds())}},
+	}
+	for _, p := range purges {
+		result, err := db.Exec(p.query, p.args...)
+		if err != nil {
+			log.Printf("Error purging %s: %v", p.name, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			log.Printf("Purged %d %s", n, p.name)
+		}
+	}
+
+	if n, err := purgeAbandonedAccounts(db, retention); err != nil {
+		log.Printf("Error purging abandoned accounts: %v", err)
+	} else if n > 0 {
+		log.Printf("Purged %d abandoned unverified accounts", n)
+	}
+}
+
+// Delete unverified accounts older than the retention period along with their dependent rows
+func purgeAbandonedAccounts(db *sql.DB, retentionSeconds int) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	abandoned := "SELECT acc_id FROM accounts WHERE NOT is_email_verified AND created_at < NOW() - $1 * INTERVAL '1 second'"
+	for _, table := range []string{"email_verifications", "one_time_codes", "login_challenges", "password_resets", "sessions", "known_devices", "device_alerts", "trusted_devices", "magic_links"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE acc_id IN ("+abandoned+")", retentionSeconds); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM accounts WHERE acc_id IN ("+abandoned+")", retentionSeconds)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -1,15 +1,21 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Account struct represents the user account with verification status and 2FA secret
 type Account struct {
 	AccID             uint64 `json:"AccID"`
 	UserName          string `json:"Username"`
 	Email             string `json:"Email"`
-	EncryptedPassword string `json:"EncryptedPassword"`
-	SecretKey2FA      string `json:"SecretKey2FA"`
+	EncryptedPassword string `json:"-"`
+	SecretKey2FA      string `json:"-"`               // Sealed with the secrets keyring; never serialized
 	IsEmailVerified   bool   `json:"IsEmailVerified"` // Indicates if the email is verified
+	TwoFactorMethod   string `json:"TwoFactorMethod"` // How the second factor is delivered ("email" or "totp")
+	TOTPEnabled       bool   `json:"TOTPEnabled"`     // Indicates if an authenticator app has been enrolled
+	Role              string `json:"Role"`            // Access level ("player", "moderator" or "admin")
 }
 
 // AccountWithClassAndScore struct includes class ID, score, and rank information for the account
@@ -22,19 +28,58 @@ type AccountWithClassAndScore struct {
 	Rank     int    `json:"Rank"`
 }
 
-// Session struct represents a user session with expiration and additional metadata
+// Session struct represents a user session with expiration and the client it was issued to
 type Session struct {
 	SessionID      string    `json:"SessionID"`
 	AccID          uint64    `json:"AccID"`
-	Metadata       string    `json:"Metadata"`       // Additional metadata (user agent, IP, etc.)
+	IPAddress      string    `json:"IPAddress"`      // Client IP the session was issued to
+	UserAgent      string    `json:"UserAgent"`      // Client user agent the session was issued to
+	CreatedAt      time.Time `json:"CreatedAt"`      // Time when the session was created
+	LastSeenAt     time.Time `json:"LastSeenAt"`     // Time when the session was last used
 	ExpiryDateTime time.Time `json:"ExpiryDateTime"` // Expiry time of the session
 }
 
+// SessionDevice struct describes one of an account's active sessions for the device list
+type SessionDevice struct {
+	SessionID  string    `json:"SessionID"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	LastSeenAt time.Time `json:"LastSeenAt"`
+	IPAddress  string    `json:"IPAddress"`
+	UserAgent  string    `json:"UserAgent"`
+	Browser    string    `json:"Browser"` // Browser parsed from the user agent
+	OS         string    `json:"OS"`      // Operating system parsed from the user agent
+	Current    bool      `json:"Current"` // Whether this is the session making the request
+}
+
+// TrustedDevice struct describes a browser allowed to skip the second factor
+type TrustedDevice struct {
+	DeviceID   string    `json:"DeviceID"`
+	Label      string    `json:"Label"` // Name chosen by the user or derived from the user agent
+	IPAddress  string    `json:"IPAddress"`
+	CreatedAt  time.Time `json:"CreatedAt"`
+	LastUsedAt time.Time `json:"LastUsedAt"`
+	ExpiresAt  time.Time `json:"ExpiresAt"`
+	Current    bool      `json:"Current"` // Whether this is the browser making the request
+}
+
 // EmailVerification struct represents the email verification entry with token and 2FA secret
 type EmailVerification struct {
 	ID                uint64    `json:"ID"`
 	AccID             uint64    `json:"AccID"`
 	VerificationToken string    `json:"VerificationToken"`
-	SecretKey2FA      string    `json:"SecretKey2FA"`
-	CreatedAt         time.Time `json:"CreatedAt"` // Time when the verification was created
+	SecretKey2FA      string    `json:"SecretKey2FA"` // Set for registration verifications
+	NewEmail          string    `json:"NewEmail"`     // Set for email change verifications
+	CreatedAt         time.Time `json:"CreatedAt"`    // Time when the verification was created
+}
+
+// AuditEvent struct represents an entry in the security audit log
+type AuditEvent struct {
+	ID        uint64          `json:"ID"`
+	EventType string          `json:"EventType"`
+	AccID     *uint64         `json:"AccID"`   // Account the event is about, if known
+	ActorID   *uint64         `json:"ActorID"` // Account that caused the event when it was someone else
+	IPAddress string          `json:"IPAddress"`
+	UserAgent string          `json:"UserAgent"`
+	Details   json.RawMessage `json:"Details,omitempty"`
+	CreatedAt time.Time       `json:"CreatedAt"`
 }
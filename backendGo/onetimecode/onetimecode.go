@@ -0,0 +1,143 @@
+package onetimecode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"backendGo/config"
+)
+
+// Purposes a one-time code can be issued for
+const (
+	PurposeLogin = "login"
+)
+
+var (
+	ErrInvalidCode     = errors.New("invalid code")
+	ErrNoActiveCode    = errors.New("no active code")
+	ErrTooManyAttempts = errors.New("too many attempts")
+	ErrResendTooSoon   = errors.New("code was sent too recently")
+	errInvalidLength   = errors.New("code length must be between 4 and 10 digits")
+)
+
+// CooldownError reports how long to wait before another code can be sent
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%v, retry in %s", ErrResendTooSoon, e.RetryAfter.Round(time.Second))
+}
+
+func (e *CooldownError) Unwrap() error {
+	return ErrResendTooSoon
+}
+
+// Generate a random numeric code of the configured length
+func generateCode(length int) (string, error) {
+	if length < 4 || length > 10 {
+		return "", errInvalidLength
+	}
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", length, n), nil
+}
+
+// Hash a code bound to the account and purpose so that only its digest is stored
+func hashCode(accountID uint64, purpose, code string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%s:%s", accountID, purpose, code)))
+	return hex.EncodeToString(hash[:])
+}
+
+// Issue a fresh code for the account, replacing any previous one, unless one was sent within the cooldown
+func Issue(db *sql.DB, accountID uint64, purpose string) (string, error) {
+	var createdAt time.Time
+	err := db.QueryRow("SELECT created_at FROM one_time_codes WHERE acc_id = $1 AND purpose = $2 AND expires_at > NOW()", accountID, purpose).Scan(&createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if err == nil {
+		if wait := config.LoginCodeResendCooldown - time.Since(createdAt); wait > 0 {
+			return "", &CooldownError{RetryAfter: wait}
+		}
+	}
+
+	code, err := generateCode(config.LoginCodeLength)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO one_time_codes (acc_id, purpose, code_hash, attempts, created_at, expires_at)
+		VALUES ($1, $2, $3, 0, NOW(), $4)
+		ON CONFLICT (acc_id, purpose) DO UPDATE SET code_hash = EXCLUDED.code_hash, attempts = 0, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at`,
+		accountID, purpose, hashCode(accountID, purpose, code), time.Now().Add(config.LoginCodeLifetime))
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Check whether the account has an unexpired code for the purpose
+func HasActive(db *sql.DB, accountID uint64, purpose string) (bool, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM one_time_codes WHERE acc_id = $1 AND purpose = $2 AND expires_at > NOW())", accountID, purpose).Scan(&exists)
+	return exists, err
+}
+
+// Verify a code, counting the attempt and consuming the code on success
+func Verify(db *sql.DB, accountID uint64, purpose, code string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var codeHash string
+	var attempts int
+	err = tx.QueryRow("SELECT code_hash, attempts FROM one_time_codes WHERE acc_id = $1 AND purpose = $2 AND expires_at > NOW() FOR UPDATE", accountID, purpose).Scan(&codeHash, &attempts)
+	if err == sql.ErrNoRows {
+		return ErrNoActiveCode
+	}
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashCode(accountID, purpose, code))) == 1 {
+		// Codes are single-use
+		if _, err := tx.Exec("DELETE FROM one_time_codes WHERE acc_id = $1 AND purpose = $2", accountID, purpose); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	attempts++
+	if attempts >= config.LoginCodeMaxAttempts {
+		// Burn the code so it cannot be guessed further
+		if _, err := tx.Exec("DELETE FROM one_time_codes WHERE acc_id = $1 AND purpose = $2", accountID, purpose); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		return ErrTooManyAttempts
+	}
+
+	if _, err := tx.Exec("UPDATE one_time_codes SET attempts = $1 WHERE acc_id = $2 AND purpose = $3", attempts, accountID, purpose); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return ErrInvalidCode
+}
@@ -0,0 +1,211 @@
+package outbox
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"backendGo/config"
+	"backendGo/mailer"
+	"backendGo/secrets"
+
+	"github.com/google/uuid"
+)
+
+// Delivery states of an outbox message
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusDead    = "dead" // Gave up after too many failed attempts
+)
+
+// ErrNotFound is returned when no message has the given ID
+var ErrNotFound = errors.New("message not found")
+
+// Queue stores outgoing email in the database and delivers it from a background worker
+type Queue struct {
+	db        *sql.DB
+	transport mailer.Mailer
+	wake      chan struct{}
+}
+
+// DeliveryStatus reports how far a queued message has got
+type DeliveryStatus struct {
+	ID            string     `json:"ID"`
+	Status        string     `json:"Status"`
+	Attempts      int        `json:"Attempts"`
+	CreatedAt     time.Time  `json:"CreatedAt"`
+	LastAttemptAt *time.Time `json:"LastAttemptAt"`
+	SentAt        *time.Time `json:"SentAt"`
+}
+
+// Create a queue that delivers through the given transport
+func New(db *sql.DB, transport mailer.Mailer) *Queue {
+	return &Queue{db: db, transport: transport, wake: make(chan struct{}, 1)}
+}
+
+// Store a message for delivery and return its public ID; bodies carry codes and links, so they are stored encrypted
+func (q *Queue) Enqueue(msg mailer.Message) (string, error) {
+	textBody, err := secrets.Encrypt(msg.Body)
+	if err != nil {
+		return "", err
+	}
+	htmlBody, err := secrets.Encrypt(msg.HTMLBody)
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	_, err = q.db.Exec("INSERT INTO email_outbox (public_id, recipient, subject, text_body, html_body, status, next_attempt_at) VALUES ($1, $2, $3, $4, $5, $6, NOW())",
+		id, msg.To, msg.Subject, textBody, htmlBody, StatusPending)
+	if err != nil {
+		return "", err
+	}
+
+	// Nudge the worker so the message goes out without waiting for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Send queues the message, satisfying mailer.Mailer
+func (q *Queue) Send(msg mailer.Message) error {
+	_, err := q.Enqueue(msg)
+	return err
+}
+
+// Start the background delivery worker
+func (q *Queue) Start() {
+	go func() {
+		ticker := time.NewTicker(config.OutboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Keep draining while full batches come back
+			for q.deliverBatch() == config.OutboxBatchSize {
+			}
+			select {
+			case <-ticker.C:
+			case <-q.wake:
+			}
+		}
+	}()
+}
+
+// Delay before retrying after the given number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	delay := config.OutboxRetryBase
+	for i := 1; i < attempts && delay < config.OutboxRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > config.OutboxRetryMax {
+		delay = config.OutboxRetryMax
+	}
+	return delay
+}
+
+// Claim and deliver one batch of due messages, returning how many were claimed
+func (q *Queue) deliverBatch() int {
+	// Leasing the rows keeps other workers away while the SMTP calls run outside a transaction
+	rows, err := q.db.Query(`
+		UPDATE email_outbox SET next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = $2 AND next_attempt_at <= NOW()
+			ORDER BY id LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, recipient, subject, text_body, COALESCE(html_body, ''), attempts`,
+		int(config.OutboxLease.Seconds()), StatusPending, config.OutboxBatchSize)
+	if err != nil {
+		log.Printf("Error claiming outbox messages: %v", err)
+		return 0
+	}
+
+	type claimed struct {
+		id       int64
+		msg      mailer.Message
+		attempts int
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		if err := rows.Scan(&c.id, &c.msg.To, &c.msg.Subject, &c.msg.Body, &c.msg.HTMLBody, &c.attempts); err != nil {
+			log.Printf("Error reading outbox message: %v", err)
+			continue
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+
+	for _, c := range batch {
+		q.deliver(c.id, c.msg, c.attempts)
+	}
+	return len(batch)
+}
+
+// Decrypt the bodies of a claimed message
+func open(msg mailer.Message) (mailer.Message, error) {
+	var err error
+	if msg.Body, err = secrets.Decrypt(msg.Body); err != nil {
+		return msg, err
+	}
+	msg.HTMLBody, err = secrets.Decrypt(msg.HTMLBody)
+	return msg, err
+}
+
+// Attempt delivery of one message and record the outcome
+func (q *Queue) deliver(id int64, msg mailer.Message, attempts int) {
+	attempts++
+
+	// A body sealed with a retired key can never be sent, so it is dead-lettered straight away
+	msg, openErr := open(msg)
+	sendErr := openErr
+	if openErr == nil {
+		sendErr = q.transport.Send(msg)
+	}
+
+	var err error
+	switch {
+	case sendErr == nil:
+		// Bodies may carry codes and links, so they are dropped once delivered
+		_, err = q.db.Exec("UPDATE email_outbox SET status = $1, attempts = $2, last_attempt_at = NOW(), sent_at = NOW(), last_error = NULL, text_body = '', html_body = NULL WHERE id = $3",
+			StatusSent, attempts, id)
+	case openErr != nil || attempts >= config.OutboxMaxAttempts:
+		log.Printf("Giving up on outbox message %d after %d attempts: %v", id, attempts, sendErr)
+		_, err = q.db.Exec("UPDATE email_outbox SET status = $1, attempts = $2, last_attempt_at = NOW(), last_error = $3, text_body = '', html_body = NULL WHERE id = $4",
+			StatusDead, attempts, sendErr.Error(), id)
+	default:
+		log.Printf("Error sending outbox message %d (attempt %d): %v", id, attempts, sendErr)
+		_, err = q.db.Exec("UPDATE email_outbox SET attempts = $1, last_attempt_at = NOW(), last_error = $2, next_attempt_at = $3 WHERE id = $4",
+			attempts, sendErr.Error(), time.Now().Add(retryDelay(attempts)), id)
+	}
+	if err != nil {
+		log.Printf("Error recording outbox delivery for message %d: %v", id, err)
+	}
+}
+
+// Look up the delivery status of a message by its public ID
+func Status(db *sql.DB, id string) (DeliveryStatus, error) {
+	var status DeliveryStatus
+	var lastAttemptAt, sentAt sql.NullTime
+	err := db.QueryRow("SELECT public_id, status, attempts, created_at, last_attempt_at, sent_at FROM email_outbox WHERE public_id = $1", id).Scan(
+		&status.ID, &status.Status, &status.Attempts, &status.CreatedAt, &lastAttemptAt, &sentAt,
+	)
+	if err == sql.ErrNoRows {
+		return DeliveryStatus{}, ErrNotFound
+	}
+	if err != nil {
+		return DeliveryStatus{}, err
+	}
+
+	if lastAttemptAt.Valid {
+		status.LastAttemptAt = &lastAttemptAt.Time
+	}
+	if sentAt.Valid {
+		status.SentAt = &sentAt.Time
+	}
+	return status, nil
+}
@@ -0,0 +1,104 @@
+package passhash
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"backendGo/config"
+)
+
+// ErrUnknownFormat is returned for stored hashes no registered hasher recognizes
+var ErrUnknownFormat = errors.New("unrecognized password hash format")
+
+// ErrMalformedHash is returned when a recognized hash cannot be decoded
+var ErrMalformedHash = errors.New("malformed password hash")
+
+// Hasher produces and checks PHC-formatted password hashes for one algorithm
+type Hasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	Recognizes(encoded string) bool
+	NeedsRehash(encoded string) bool // True when the hash was made with other parameters
+}
+
+// Default hasher for new passwords
+var Default Hasher = configuredArgon2id()
+
+// Rebuild the default hasher and the shared pool from the configuration; call after config.Load and before hashing anything
+func Configure() {
+	Default = configuredArgon2id()
+	Workers = NewPool(config.HashPoolWorkers, config.HashPoolQueueSize)
+}
+
+func configuredArgon2id() *Argon2id {
+	return NewArgon2id(Argon2idParams{
+		Memory:      uint32(config.Argon2Memory),
+		Iterations:  uint32(config.Argon2Iterations),
+		Parallelism: uint8(config.Argon2Parallelism),
+		SaltLength:  uint32(config.Argon2SaltLength),
+		KeyLength:   uint32(config.Argon2KeyLength),
+	})
+}
+
+// Hashers that can still verify older hashes
+var legacy = []Hasher{Bcrypt{}}
+
+// Hash a password with the default hasher
+func Hash(password string) (string, error) {
+	return Default.Hash(password)
+}
+
+// Verify a password against a stored hash of any supported format
+func Verify(encoded, password string) (bool, error) {
+	hasher := hasherFor(encoded)
+	if hasher == nil {
+		return false, ErrUnknownFormat
+	}
+	return hasher.Verify(encoded, password)
+}
+
+// Verify like Verify, but with every check costing at least one default-hasher verification,
+// so an unknown username or a legacy or unrecognized stored hash does not answer faster than a current one
+func VerifyEvenly(encoded, password string) (bool, error) {
+	ok, err := Verify(encoded, password)
+	if !Default.Recognizes(encoded) {
+		Default.Verify(DummyHash(), password)
+	}
+	return ok, err
+}
+
+// Hash to check a password against when there is no stored one, such as for an unknown username
+func DummyHash() string {
+	return dummyHash()
+}
+
+// Throwaway default-hasher hash, made once on first use
+var dummyHash = sync.OnceValue(func() string {
+	encoded, err := Default.Hash("not-a-real-password")
+	if err != nil {
+		log.Fatalf("Error creating dummy password hash: %v", err)
+	}
+	return encoded
+})
+
+// Report whether a stored hash should be replaced by a fresh one from the default hasher
+func NeedsRehash(encoded string) bool {
+	if Default.Recognizes(encoded) {
+		return Default.NeedsRehash(encoded)
+	}
+	return true
+}
+
+// Find the hasher that produced a stored hash
+func hasherFor(encoded string) Hasher {
+	if Default.Recognizes(encoded) {
+		return Default
+	}
+	for _, hasher := range legacy {
+		if hasher.Recognizes(encoded) {
+			return hasher
+		}
+	}
+	return nil
+}
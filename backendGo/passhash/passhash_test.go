@@ -0,0 +1,239 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters so the tests stay fast
+var testParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// Replace the default hasher for the duration of a test
+func useDefault(t *testing.T, hasher Hasher) {
+	t.Helper()
+	previous := Default
+	Default = hasher
+	t.Cleanup(func() { Default = previous })
+}
+
+func bcryptHash(t *testing.T, password string, cost int) string {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	return string(hashed)
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	hasher := NewArgon2id(testParams)
+	encoded, err := hasher.Hash("correct horse battery")
+	if err != nil {
+		t.Fatalf("Hash returned %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Hash = %q, want the parameters encoded in PHC format", encoded)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"correct horse battery", true},
+		{"correct horse battery ", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		ok, err := hasher.Verify(encoded, tt.password)
+		if err != nil || ok != tt.want {
+			t.Errorf("Verify(%q) = %v, %v; want %v, nil", tt.password, ok, err, tt.want)
+		}
+	}
+
+	other, _ := hasher.Hash("correct horse battery")
+	if other == encoded {
+		t.Error("two hashes of the same password are identical, want distinct salts")
+	}
+}
+
+func TestArgon2idVerifyUsesEncodedParams(t *testing.T) {
+	old, _ := NewArgon2id(Argon2idParams{Memory: 32, Iterations: 2, Parallelism: 1, SaltLength: 8, KeyLength: 16}).Hash("password")
+	ok, err := NewArgon2id(testParams).Verify(old, "password")
+	if err != nil || !ok {
+		t.Errorf("Verify of a hash with other parameters = %v, %v; want true, nil", ok, err)
+	}
+}
+
+func TestDecodeArgon2idRejectsMalformed(t *testing.T) {
+	valid, _ := NewArgon2id(testParams).Hash("password")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{"too many parts", valid + "$extra"},
+		{"wrong algorithm", "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{"missing version", "$argon2id$19$m=64,t=1,p=1$" + salt + "$" + key},
+		{"bad params", "$argon2id$v=19$m=64,t=1$" + salt + "$" + key},
+		{"non-numeric params", "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key},
+		{"empty salt", "$argon2id$v=19$m=64,t=1,p=1$$" + key},
+		{"invalid salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key},
+		{"empty key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{"invalid key", "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := decodeArgon2id(tt.encoded); !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("decodeArgon2id(%q) error = %v, want ErrMalformedHash", tt.encoded, err)
+			}
+			if ok, err := NewArgon2id(testParams).Verify(tt.encoded, "password"); ok || err == nil {
+				t.Errorf("Verify(%q) = %v, %v; want false and an error", tt.encoded, ok, err)
+			}
+		})
+	}
+
+	params, _, _, err := decodeArgon2id(valid)
+	if err != nil {
+		t.Fatalf("decodeArgon2id(valid) returned %v", err)
+	}
+	want := testParams
+	want.SaltLength, want.KeyLength = 16, 32
+	if params != want {
+		t.Errorf("decoded params = %+v, want %+v", params, want)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	useDefault(t, NewArgon2id(testParams))
+
+	current, _ := Default.Hash("password")
+	moreMemory := testParams
+	moreMemory.Memory = 128
+	weaker, _ := NewArgon2id(moreMemory).Hash("password")
+	longerSalt := testParams
+	longerSalt.SaltLength = 32
+	otherSalt, _ := NewArgon2id(longerSalt).Hash("password")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current parameters", current, false},
+		{"other memory", weaker, true},
+		{"other salt length", otherSalt, true},
+		{"bcrypt", bcryptHash(t, "password", bcrypt.MinCost), true},
+		{"malformed argon2id", "$argon2id$v=19$garbage", true},
+		{"unknown format", "plaintext", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    bool
+	}{
+		{"$2a$10$abcdefghijklmnopqrstuv", true},
+		{"$2b$10$abcdefghijklmnopqrstuv", true},
+		{"$2y$10$abcdefghijklmnopqrstuv", true},
+		{"$2x$10$abcdefghijklmnopqrstuv", false},
+		{"$argon2id$v=19$m=64,t=1,p=1$a$b", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := (Bcrypt{}).Recognizes(tt.encoded); got != tt.want {
+			t.Errorf("Recognizes(%q) = %v, want %v", tt.encoded, got, tt.want)
+		}
+	}
+
+	cheap := bcryptHash(t, "password", bcrypt.MinCost)
+	if !(Bcrypt{}).NeedsRehash(cheap) {
+		t.Error("NeedsRehash for a cost below the default = false, want true")
+	}
+	if ok, err := (Bcrypt{}).Verify(cheap, "password"); !ok || err != nil {
+		t.Errorf("Verify(correct) = %v, %v; want true, nil", ok, err)
+	}
+	if ok, err := (Bcrypt{}).Verify(cheap, "wrong"); ok || err != nil {
+		t.Errorf("Verify(wrong) = %v, %v; want false, nil", ok, err)
+	}
+	if _, err := (Bcrypt{}).Verify("$2a$broken", "password"); !errors.Is(err, ErrMalformedHash) {
+		t.Errorf("Verify(broken) error = %v, want ErrMalformedHash", err)
+	}
+}
+
+func TestVerifyDispatchesByFormat(t *testing.T) {
+	useDefault(t, NewArgon2id(testParams))
+	argon, _ := Hash("password")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+		wantErr error
+	}{
+		{"argon2id", argon, true, nil},
+		{"bcrypt", bcryptHash(t, "password", bcrypt.MinCost), true, nil},
+		{"unknown format", "password", false, ErrUnknownFormat},
+		{"empty", "", false, ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, verify := range []func(string, string) (bool, error){Verify, VerifyEvenly} {
+				ok, err := verify(tt.encoded, "password")
+				if ok != tt.want || !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, %v; want %v, %v", ok, err, tt.want, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+// Hasher that counts how often it is asked to verify
+type countingHasher struct {
+	*Argon2id
+	verifies int
+}
+
+func (c *countingHasher) Verify(encoded, password string) (bool, error) {
+	c.verifies++
+	return c.Argon2id.Verify(encoded, password)
+}
+
+func TestVerifyEvenlyCostsOneDefaultVerification(t *testing.T) {
+	counter := &countingHasher{Argon2id: NewArgon2id(testParams)}
+	useDefault(t, counter)
+	current, _ := counter.Hash("password")
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"current hash", current},
+		{"legacy hash", bcryptHash(t, "password", bcrypt.MinCost)},
+		{"unknown format", "plaintext"},
+		{"no stored hash", DummyHash()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter.verifies = 0
+			VerifyEvenly(tt.encoded, "password")
+			if counter.verifies != 1 {
+				t.Errorf("default hasher verified %d times, want exactly 1", counter.verifies)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package passhash
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backendGo/config"
+)
+
+// ErrBusy is returned when the hashing queue is full
+var ErrBusy = errors.New("password hashing queue is full")
+
+// Pool bounds how many hashes run at once so bursts of logins queue instead of pinning every core
+type Pool struct {
+	workers  chan struct{} // Held while a hash runs
+	admitted chan struct{} // Held from admission until completion; running plus queued
+	queue    int
+
+	completed atomic.Int64
+	rejected  atomic.Int64
+	canceled  atomic.Int64
+
+	mu        sync.Mutex
+	waitCount int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// PoolStats is a snapshot of pool load and queue wait times
+type PoolStats struct {
+	Workers       int     `json:"workers"`
+	QueueSize     int     `json:"queueSize"`
+	Running       int     `json:"running"`
+	Queued        int     `json:"queued"`
+	Completed     int64   `json:"completed"`
+	Rejected      int64   `json:"rejected"`
+	Canceled      int64   `json:"canceled"`
+	AverageWaitMs float64 `json:"averageWaitMs"`
+	MaxWaitMs     float64 `json:"maxWaitMs"`
+}
+
+// Pool shared by every request handler and the seeder
+var Workers = NewPool(config.HashPoolWorkers, config.HashPoolQueueSize)
+
+// Create a pool running at most workers hashes at once with up to queue callers waiting; zero workers means one per CPU
+func NewPool(workers, queue int) *Pool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Pool{
+		workers:  make(chan struct{}, workers),
+		admitted: make(chan struct{}, workers+queue),
+		queue:    queue,
+	}
+}
+
+// Hash a password with the default hasher once a worker is free
+func (p *Pool) Hash(ctx context.Context, password string) (string, error) {
+	var encoded string
+	var hashErr error
+	if err := p.run(ctx, func() { encoded, hashErr = Hash(password) }); err != nil {
+		return "", err
+	}
+	return encoded, hashErr
+}
+
+// Verify a password against a stored hash once a worker is free, taking the same time whatever algorithm produced it
+func (p *Pool) Verify(ctx context.Context, encoded, password string) (bool, error) {
+	var ok bool
+	var verifyErr error
+	if err := p.run(ctx, func() { ok, verifyErr = VerifyEvenly(encoded, password) }); err != nil {
+		return false, err
+	}
+	return ok, verifyErr
+}
+
+// Run fn on the caller's goroutine once a worker slot is free, giving up if the queue is full or ctx ends first
+func (p *Pool) run(ctx context.Context, fn func()) error {
+	select {
+	case p.admitted <- struct{}{}:
+	default:
+		p.rejected.Add(1)
+		return ErrBusy
+	}
+	defer func() { <-p.admitted }()
+
+	queuedAt := time.Now()
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		p.recordWait(time.Since(queuedAt))
+		p.canceled.Add(1)
+		return ctx.Err()
+	}
+	p.recordWait(time.Since(queuedAt))
+	defer func() { <-p.workers }()
+
+	fn()
+	p.completed.Add(1)
+	return nil
+}
+
+// Add a queue wait to the running totals
+func (p *Pool) recordWait(wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.waitCount++
+	p.totalWait += wait
+	if wait > p.maxWait {
+		p.maxWait = wait
+	}
+}
+
+// Take a snapshot of the pool's counters
+func (p *Pool) Stats() PoolStats {
+	running := len(p.workers)
+	queued := len(p.admitted) - running
+	if queued < 0 {
+		queued = 0
+	}
+
+	stats := PoolStats{
+		Workers:   cap(p.workers),
+		QueueSize: p.queue,
+		Running:   running,
+		Queued:    queued,
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+		Canceled:  p.canceled.Load(),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.waitCount > 0 {
+		stats.AverageWaitMs = float64(p.totalWait.Microseconds()) / float64(p.waitCount) / 1000
+	}
+	stats.MaxWaitMs = float64(p.maxWait.Microseconds()) / 1000
+	return stats
+}
@@ -0,0 +1,102 @@
+package passwordreset
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"backendGo/config"
+	"backendGo/utils"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, expired or already-used reset tokens
+	ErrInvalidToken = errors.New("invalid or expired reset token")
+	// ErrSentTooSoon is returned when the account was sent a reset link within the cooldown
+	ErrSentTooSoon = errors.New("reset link was sent too recently")
+)
+
+// Create a reset token for the account, invalidating any earlier unused ones, unless one was issued within the cooldown
+func Create(db *sql.DB, accountID uint64) (string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var createdAt time.Time
+	err = tx.QueryRow("SELECT created_at FROM password_resets WHERE acc_id = $1 AND expires_at > NOW() ORDER BY created_at DESC LIMIT 1 FOR UPDATE", accountID).Scan(&createdAt)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if err == nil && time.Since(createdAt) < config.PasswordResetCooldown {
+		return "", ErrSentTooSoon
+	}
+
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE acc_id = $1", accountID); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("INSERT INTO password_resets (token_hash, acc_id, expires_at) VALUES ($1, $2, $3)",
+		utils.HashToken(token), accountID, time.Now().Add(config.PasswordResetLifetime))
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Find the account a live reset token was issued for without using it up
+func Lookup(db *sql.DB, token string) (uint64, error) {
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	var accountID uint64
+	err := db.QueryRow("SELECT acc_id FROM password_resets WHERE token_hash = $1 AND expires_at > NOW()", utils.HashToken(token)).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
+
+// Consume a reset token and set the new password hash on its account in one transaction
+func Apply(db *sql.DB, token, hashedPassword string) (uint64, error) {
+	if token == "" {
+		return 0, ErrInvalidToken
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var accountID uint64
+	err = tx.QueryRow("DELETE FROM password_resets WHERE token_hash = $1 AND expires_at > NOW() RETURNING acc_id", utils.HashToken(token)).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE accounts SET encrypted_password = $1, must_reset_password = FALSE WHERE acc_id = $2", hashedPassword, accountID); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return accountID, nil
+}
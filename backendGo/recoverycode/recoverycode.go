@@ -0,0 +1,102 @@
+package recoverycode
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+
+	"backendGo/config"
+	"backendGo/utils"
+
+	"github.com/lib/pq"
+)
+
+// Lowercase base32 without padding avoids ambiguous symbols and is easy to type
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Generate a single recovery code formatted as two groups of five characters
+func generateCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := encoding.EncodeToString(b)[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// Normalize user input so that case, spaces and dashes do not matter
+func normalize(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// Create a fresh set of codes along with the hashes to store
+func newSet() ([]string, []string, error) {
+	codes := make([]string, 0, config.RecoveryCodeCount)
+	hashes := make([]string, 0, config.RecoveryCodeCount)
+	for i := 0; i < config.RecoveryCodeCount; i++ {
+		code, err := generateCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(normalize(code)))
+	}
+	return codes, hashes, nil
+}
+
+// Replace the account's recovery codes with a fresh set and return them in plaintext
+func Generate(db *sql.DB, accountID uint64) ([]string, error) {
+	codes, hashes, err := newSet()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec("UPDATE accounts SET recovery_codes = $1 WHERE acc_id = $2", pq.Array(hashes), accountID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Give the account its first set of recovery codes, returning nil if it has ever been issued one
+func GenerateIfMissing(db *sql.DB, accountID uint64) ([]string, error) {
+	codes, hashes, err := newSet()
+	if err != nil {
+		return nil, err
+	}
+
+	// A used-up set is an empty array, so only accounts that never had codes still hold NULL
+	result, err := db.Exec("UPDATE accounts SET recovery_codes = $1 WHERE acc_id = $2 AND recovery_codes IS NULL", pq.Array(hashes), accountID)
+	if err != nil {
+		return nil, err
+	}
+	if issued, _ := result.RowsAffected(); issued == 0 {
+		return nil, nil
+	}
+	return codes, nil
+}
+
+// Consume a recovery code, reporting whether it was valid and unused
+func Consume(db *sql.DB, accountID uint64, code string) (bool, error) {
+	hash := utils.HashToken(normalize(code))
+	result, err := db.Exec("UPDATE accounts SET recovery_codes = array_remove(recovery_codes, $1) WHERE acc_id = $2 AND $1 = ANY(recovery_codes)", hash, accountID)
+	if err != nil {
+		return false, err
+	}
+
+	consumed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return consumed > 0, nil
+}
+
+// Count the account's unused recovery codes
+func Remaining(db *sql.DB, accountID uint64) (int, error) {
+	var remaining int
+	err := db.QueryRow("SELECT COALESCE(cardinality(recovery_codes), 0) FROM accounts WHERE acc_id = $1", accountID).Scan(&remaining)
+	return remaining, err
+}
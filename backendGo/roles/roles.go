@@ -0,0 +1,36 @@
+package roles
+
+// Account roles, from least to most privileged
+const (
+	Player    = "player"
+	Moderator = "moderator"
+	Admin     = "admin"
+)
+
+// Permission names an action that only some roles may perform
+type Permission string
+
+// Permissions checked by route middleware
+const (
+	ViewMetrics Permission = "metrics:view"
+	ManageRoles Permission = "roles:manage"
+	ViewAudit   Permission = "audit:view"
+)
+
+// Permissions granted to each role; higher roles list everything lower roles can do
+var grants = map[string]map[Permission]bool{
+	Player:    {},
+	Moderator: {ViewMetrics: true},
+	Admin:     {ViewMetrics: true, ManageRoles: true, ViewAudit: true},
+}
+
+// Report whether a role name is known
+func Valid(role string) bool {
+	_, ok := grants[role]
+	return ok
+}
+
+// Report whether the role grants the permission
+func Allows(role string, permission Permission) bool {
+	return grants[role][permission]
+}
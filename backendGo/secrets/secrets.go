@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Prefix marking an encrypted value; anything without it is legacy plaintext
+const prefix = "enc:"
+
+// ErrNoKeys is returned when encryption is used before keys are loaded
+var ErrNoKeys = errors.New("no encryption keys loaded")
+
+// ErrUnknownKey is returned for ciphertexts sealed with a key that is no longer configured
+var ErrUnknownKey = errors.New("ciphertext was sealed with an unknown key")
+
+// ErrMalformed is returned for values that carry the prefix but cannot be decoded
+var ErrMalformed = errors.New("malformed ciphertext")
+
+// Keyring holds every known AEAD by key ID; new values are sealed with the active key
+type Keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// Keyring used by Encrypt and Decrypt
+var keys *Keyring
+
+// Load keys from ENCRYPTION_KEYS, a comma-separated list of id:base64key entries with the active key first
+func LoadFromEnv() error {
+	spec := os.Getenv("ENCRYPTION_KEYS")
+	if spec == "" {
+		return errors.New("ENCRYPTION_KEYS is not set; generate a key with `openssl rand -base64 32` and set ENCRYPTION_KEYS=<id>:<key>")
+	}
+
+	keyring, err := ParseKeyring(spec)
+	if err != nil {
+		return err
+	}
+	keys = keyring
+	return nil
+}
+
+// Parse a keyring specification of comma-separated id:base64key entries, the first being active
+func ParseKeyring(spec string) (*Keyring, error) {
+	keyring := &Keyring{aeads: make(map[string]cipher.AEAD)}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encodedKey, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || id == "" {
+			return nil, fmt.Errorf("encryption key entry %q must have the form id:base64key", entry)
+		}
+		if _, duplicate := keyring.aeads[id]; duplicate {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes of base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		if keyring.active == "" {
+			keyring.active = id
+		}
+		keyring.aeads[id] = aead
+	}
+	return keyring, nil
+}
+
+// Seal a value with the active key as enc:<key id>:<base64 nonce and ciphertext>; empty values stay empty
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	if keys == nil {
+		return "", ErrNoKeys
+	}
+
+	aead := keys.aeads[keys.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(keys.active))
+	return prefix + keys.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open a stored value, passing legacy plaintext through unchanged
+func Decrypt(stored string) (string, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return stored, nil
+	}
+	if keys == nil {
+		return "", ErrNoKeys
+	}
+
+	id, encoded, found := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	if !found {
+		return "", ErrMalformed
+	}
+	aead, ok := keys.aeads[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	// The key ID is authenticated so a ciphertext cannot be relabelled
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plaintext), nil
+}
+
+// Report whether a stored value is plaintext or sealed with a key other than the active one
+func NeedsReencrypt(stored string) bool {
+	if stored == "" {
+		return false
+	}
+	if !strings.HasPrefix(stored, prefix) {
+		return true
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(stored, prefix), ":")
+	return keys == nil || id != keys.active
+}
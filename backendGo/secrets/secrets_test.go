@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	keyA = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	keyB = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+// Load a keyring for the duration of a test
+func useKeys(t *testing.T, spec string) {
+	t.Helper()
+	keyring, err := ParseKeyring(spec)
+	if err != nil {
+		t.Fatalf("ParseKeyring(%q) returned %v", spec, err)
+	}
+	previous := keys
+	keys = keyring
+	t.Cleanup(func() { keys = previous })
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		active  string
+		wantErr string
+	}{
+		{"single key", "k1:" + keyA, "k1", ""},
+		{"first key is active", "k2:" + keyB + ",k1:" + keyA, "k2", ""},
+		{"spaces around entries", " k2:" + keyB + " , k1:" + keyA, "k2", ""},
+		{"missing separator", "k1" + keyA, "", "must have the form"},
+		{"empty id", ":" + keyA, "", "must have the form"},
+		{"empty spec", "", "", "must have the form"},
+		{"duplicate id", "k1:" + keyA + ",k1:" + keyB, "", "listed twice"},
+		{"not base64", "k1:not base64!", "", "32 bytes"},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("too short")), "", "32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ParseKeyring(tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if keyring.active != tt.active {
+				t.Errorf("active key = %q, want %q", keyring.active, tt.active)
+			}
+		})
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	useKeys(t, "k1:"+keyA)
+
+	for _, plaintext := range []string{"JBSWY3DPEHPK3PXP", "ünïcödé", strings.Repeat("x", 4096)} {
+		sealed, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt returned %v", err)
+		}
+		if !strings.HasPrefix(sealed, "enc:k1:") || strings.Contains(sealed, plaintext) {
+			t.Errorf("Encrypt(%.20q) = %.40q, want an enc:k1: value hiding the plaintext", plaintext, sealed)
+		}
+		again, _ := Encrypt(plaintext)
+		if again == sealed {
+			t.Error("sealing the same value twice gave identical output, want fresh nonces")
+		}
+
+		opened, err := Decrypt(sealed)
+		if err != nil || opened != plaintext {
+			t.Errorf("Decrypt = %.20q, %v; want %.20q, nil", opened, err, plaintext)
+		}
+		if NeedsReencrypt(sealed) {
+			t.Error("NeedsReencrypt of a value sealed with the active key = true, want false")
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	// Two IDs for the same key material, so only the authenticated key ID tells them apart
+	useKeys(t, "k1:"+keyA+",alias:"+keyA)
+	sealed, _ := Encrypt("secret")
+	body := strings.TrimPrefix(sealed, "enc:k1:")
+	raw, _ := base64.StdEncoding.DecodeString(body)
+	raw[len(raw)-1] ^= 1
+	tampered := "enc:k1:" + base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name    string
+		stored  string
+		want    string
+		wantErr error
+	}{
+		{"empty", "", "", nil},
+		{"legacy plaintext", "JBSWY3DPEHPK3PXP", "JBSWY3DPEHPK3PXP", nil},
+		{"sealed", sealed, "secret", nil},
+		{"unknown key", "enc:gone:" + body, "", ErrUnknownKey},
+		{"relabelled key", "enc:alias:" + body, "", ErrMalformed},
+		{"tampered", tampered, "", ErrMalformed},
+		{"missing key id", "enc:" + body, "", ErrMalformed},
+		{"not base64", "enc:k1:!!!", "", ErrMalformed},
+		{"shorter than nonce", "enc:k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.stored)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decrypt = %q, %v; want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmptyValueStaysEmpty(t *testing.T) {
+	useKeys(t, "k1:"+keyA)
+	if sealed, err := Encrypt(""); sealed != "" || err != nil {
+		t.Errorf("Encrypt(\"\") = %q, %v; want \"\", nil", sealed, err)
+	}
+	if NeedsReencrypt("") {
+		t.Error("NeedsReencrypt(\"\") = true, want false")
+	}
+}
+
+func TestNoKeys(t *testing.T) {
+	previous := keys
+	keys = nil
+	t.Cleanup(func() { keys = previous })
+
+	if _, err := Encrypt("secret"); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("Encrypt error = %v, want ErrNoKeys", err)
+	}
+	if _, err := Decrypt("enc:k1:AAAA"); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("Decrypt error = %v, want ErrNoKeys", err)
+	}
+	if got, err := Decrypt("plaintext"); got != "plaintext" || err != nil {
+		t.Errorf("Decrypt(plaintext) = %q, %v; want it passed through", got, err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	useKeys(t, "old:"+keyA)
+	sealedWithOld, _ := Encrypt("secret")
+
+	// Rotate: the new key becomes active and the old one stays for decryption
+	useKeys(t, "new:"+keyB+",old:"+keyA)
+
+	if !NeedsReencrypt(sealedWithOld) {
+		t.Error("NeedsReencrypt of a value sealed with a retired key = false, want true")
+	}
+	if !NeedsReencrypt("legacy plaintext") {
+		t.Error("NeedsReencrypt of plaintext = false, want true")
+	}
+	opened, err := Decrypt(sealedWithOld)
+	if err != nil || opened != "secret" {
+		t.Fatalf("Decrypt after rotation = %q, %v; want \"secret\", nil", opened, err)
+	}
+
+	resealed, _ := Encrypt(opened)
+	if !strings.HasPrefix(resealed, "enc:new:") || NeedsReencrypt(resealed) {
+		t.Errorf("re-encrypted value %q is not sealed with the new key", resealed)
+	}
+
+	// Once the old key is dropped its values can no longer be read
+	useKeys(t, "new:"+keyB)
+	if _, err := Decrypt(sealedWithOld); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with the old key removed error = %v, want ErrUnknownKey", err)
+	}
+}
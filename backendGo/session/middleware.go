@@ -0,0 +1,102 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backendGo/config"
+	"backendGo/models"
+	"backendGo/roles"
+	"backendGo/utils"
+)
+
+// Context keys for values stored by the auth middleware
+type contextKey string
+
+const (
+	sessionContextKey contextKey = "session"
+	accountContextKey contextKey = "account"
+)
+
+// Extract the session token from the Authorization header or the session cookie
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if cookie, err := r.Cookie(config.SessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Set the session cookie on the response
+func SetCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiry,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Clear the session cookie on the response
+func ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     config.SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Middleware that rejects unauthenticated requests and stores the session and account on the request context
+func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, account, err := Lookup(db, TokenFromRequest(r))
+		if err != nil {
+			if err != ErrInvalidSession {
+				log.Printf("Error resolving session: %v", err)
+			}
+			utils.WriteJSONResponse(w, http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), sessionContextKey, sess)
+		ctx = context.WithValue(ctx, accountContextKey, account)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Middleware that additionally rejects accounts whose role does not grant the permission
+func RequirePermission(db *sql.DB, permission roles.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		account, _ := AccountFromContext(r.Context())
+		if !roles.Allows(account.Role, permission) {
+			utils.WriteJSONResponse(w, http.StatusForbidden, map[string]string{"error": "You do not have permission to do that"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// Get the authenticated account from the request context
+func AccountFromContext(ctx context.Context) (models.Account, bool) {
+	account, ok := ctx.Value(accountContextKey).(models.Account)
+	return account, ok
+}
+
+// Get the current session from the request context
+func FromContext(ctx context.Context) (models.Session, bool) {
+	sess, ok := ctx.Value(sessionContextKey).(models.Session)
+	return sess, ok
+}
@@ -2,89 +2,195 @@ package session
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"time"
 
-	"github.com/brianvoe/gofakeit/v6"
+	"backendGo/cache"
+	"backendGo/config"
+	"backendGo/models"
+	"backendGo/utils"
+
+	"github.com/google/uuid"
 )
 
-// Generate random sessions for a given account
-func GenerateRandomSessions(db *sql.DB, accountID uint64) {
-	sessionID := gofakeit.UUID()                                                           // Random UUID for session ID
-	metadata := gofakeit.IPv4Address()                                                     // Random IP address for metadata
-	expiryDateTime := time.Now().Add(time.Minute * time.Duration(gofakeit.Number(10, 60))) // Random expiry time between 10 to 60 minutes
+// ErrInvalidSession is returned when a token does not resolve to a live session
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// Cached result of a session lookup
+type cachedSession struct {
+	Session models.Session
+	Account models.Account
+}
+
+// Build the cache key for a session lookup
+func cacheKey(tokenHash string) string {
+	return "session:" + tokenHash
+}
+
+// Create a new session for the account and return it with its bearer token
+func CreateSession(db *sql.DB, accountID uint64, ipAddress, userAgent string) (models.Session, string, error) {
+	token, err := utils.GenerateToken()
+	if err != nil {
+		return models.Session{}, "", err
+	}
+
+	sess := models.Session{
+		SessionID:      uuid.New().String(),
+		AccID:          accountID,
+		IPAddress:      ipAddress,
+		UserAgent:      userAgent,
+		CreatedAt:      time.Now(),
+		LastSeenAt:     time.Now(),
+		ExpiryDateTime: time.Now().Add(config.SessionLifetime),
+	}
 
-	var existingSessionID string
-	err := db.QueryRow("SELECT session_id FROM sessions WHERE acc_id = $1", accountID).Scan(&existingSessionID)
-	if err != nil && err != sql.ErrNoRows {
-		log.Printf("Error checking for existing session: %v", err)
-		return
+	_, err = db.Exec("INSERT INTO sessions (session_id, acc_id, token_hash, ip_address, user_agent, created_at, last_seen_at, expiry_datetime) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		sess.SessionID, sess.AccID, utils.HashToken(token), sess.IPAddress, sess.UserAgent, sess.CreatedAt, sess.LastSeenAt, sess.ExpiryDateTime)
+	if err != nil {
+		return models.Session{}, "", err
 	}
 
-	if existingSessionID != "" {
-		_, err = db.Exec("UPDATE sessions SET session_id = $1, metadata = $2, expiry_datetime = $3 WHERE acc_id = $4", sessionID, metadata, expiryDateTime, accountID)
-		if err != nil {
-			log.Printf("Error updating session for account %d: %v", accountID, err)
-			return
+	// Clean up expired sessions and evict the oldest ones beyond the per-account cap
+	_, err = deleteSessions(db, `acc_id = $1 AND (expiry_datetime <= NOW() OR session_id IN (
+		SELECT session_id FROM sessions WHERE acc_id = $1 ORDER BY created_at DESC OFFSET $2))`, accountID, config.MaxSessionsPerAcc)
+	if err != nil {
+		log.Printf("Error evicting old sessions for account %d: %v", accountID, err)
+	}
+
+	log.Printf("New session created for account %d with session ID: %s", accountID, sess.SessionID)
+	return sess, token, nil
+}
+
+// Resolve a bearer token into its session and the owning account
+func Lookup(db *sql.DB, token string) (models.Session, models.Account, error) {
+	if token == "" {
+		return models.Session{}, models.Account{}, ErrInvalidSession
+	}
+
+	key := cacheKey(utils.HashToken(token))
+	if cached, found := cache.Get(key); found {
+		entry := cached.(cachedSession)
+		if time.Now().Before(entry.Session.ExpiryDateTime) {
+			return entry.Session, entry.Account, nil
 		}
-		log.Printf("Session for account %d updated with new session ID: %s", accountID, sessionID)
-	} else {
-		_, err = db.Exec("INSERT INTO sessions (session_id, acc_id, metadata, expiry_datetime) VALUES ($1, $2, $3, $4)", sessionID, accountID, metadata, expiryDateTime)
-		if err != nil {
-			log.Printf("Error creating session for account %d: %v", accountID, err)
-			return
+		cache.Delete(key)
+		return models.Session{}, models.Account{}, ErrInvalidSession
+	}
+
+	var sess models.Session
+	var account models.Account
+	// Refresh last-seen on every cache miss, which bounds the write rate to one per SessionCacheTTL
+	err := db.QueryRow(`
+		UPDATE sessions s SET last_seen_at = NOW()
+		FROM accounts a
+		WHERE a.acc_id = s.acc_id AND s.token_hash = $1 AND s.expiry_datetime > NOW()
+		RETURNING s.session_id, s.acc_id, COALESCE(s.ip_address, ''), COALESCE(s.user_agent, ''), s.created_at, s.last_seen_at, s.expiry_datetime,
+			a.username, a.email, a.is_email_verified, a.role`, utils.HashToken(token)).Scan(
+		&sess.SessionID, &sess.AccID, &sess.IPAddress, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiryDateTime,
+		&account.UserName, &account.Email, &account.IsEmailVerified, &account.Role,
+	)
+	if err == sql.ErrNoRows {
+		return models.Session{}, models.Account{}, ErrInvalidSession
+	}
+	if err != nil {
+		return models.Session{}, models.Account{}, err
+	}
+	account.AccID = sess.AccID
+
+	cache.Set(key, cachedSession{Session: sess, Account: account}, config.SessionCacheTTL)
+	return sess, account, nil
+}
+
+// Delete sessions matching the condition and drop their cached lookups
+func deleteSessions(db *sql.DB, condition string, args ...interface{}) (int, error) {
+	rows, err := db.Query("DELETE FROM sessions WHERE "+condition+" RETURNING COALESCE(token_hash, '')", args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var tokenHash string
+		if err := rows.Scan(&tokenHash); err != nil {
+			return count, err
+		}
+		cache.Delete(cacheKey(tokenHash))
+		count++
+	}
+	return count, rows.Err()
+}
+
+// Revoke a single session belonging to the account, reporting whether it existed
+func Revoke(db *sql.DB, accountID uint64, sessionID string) (bool, error) {
+	count, err := deleteSessions(db, "session_id = $1 AND acc_id = $2", sessionID, accountID)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		log.Printf("Session %s revoked for account %d", sessionID, accountID)
+	}
+	return count > 0, nil
+}
+
+// Revoke every session belonging to the account and return how many were removed
+func RevokeAll(db *sql.DB, accountID uint64) (int, error) {
+	count, err := deleteSessions(db, "acc_id = $1", accountID)
+	if err != nil {
+		return count, err
+	}
+	log.Printf("%d sessions revoked for account %d", count, accountID)
+	return count, nil
+}
+
+// Revoke every session belonging to the account except the given one
+func RevokeOthers(db *sql.DB, accountID uint64, keepSessionID string) (int, error) {
+	count, err := deleteSessions(db, "acc_id = $1 AND session_id <> $2", accountID, keepSessionID)
+	if err != nil {
+		return count, err
+	}
+	log.Printf("%d other sessions revoked for account %d", count, accountID)
+	return count, nil
+}
+
+// Drop cached lookups for the account's sessions so changed account details are picked up
+func InvalidateAccount(db *sql.DB, accountID uint64) error {
+	rows, err := db.Query("SELECT COALESCE(token_hash, '') FROM sessions WHERE acc_id = $1", accountID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tokenHash string
+		if err := rows.Scan(&tokenHash); err != nil {
+			return err
 		}
-		log.Printf("New session generated for account %d with session ID: %s", accountID, sessionID)
+		cache.Delete(cacheKey(tokenHash))
 	}
+	return rows.Err()
 }
 
-// func GenerateSessionsForAllAccounts(db *sql.DB) {
-// 	log.Printf("Generating sessions for all test accounts")
-
-// 	// Check the current number of sessions
-// 	var sessionCount int
-// 	err := db.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&sessionCount)
-// 	if err != nil {
-// 		log.Printf("Error fetching session count: %v", err)
-// 		return
-// 	}
-
-// 	// Skip session generation if there are already 100,000 sessions
-// 	if sessionCount >= 100000 {
-// 		log.Printf("Session generation skipped, already %d test session made.", sessionCount)
-// 		return
-// 	}
-
-// 	// Get the total account count
-// 	var accountCount int
-// 	err = db.QueryRow("SELECT COUNT(*) FROM accounts").Scan(&accountCount)
-// 	if err != nil {
-// 		log.Printf("Error fetching account count: %v", err)
-// 		return
-// 	}
-
-// 	// Fetch all accounts at once
-// 	rows, err := db.Query("SELECT acc_id FROM accounts LIMIT $1", accountCount)
-// 	if err != nil {
-// 		log.Printf("Error fetching accounts: %v", err)
-// 		return
-// 	}
-// 	defer rows.Close()
-
-// 	// Iterate through all the fetched accounts
-// 	for rows.Next() {
-// 		var accID uint64
-// 		if err := rows.Scan(&accID); err != nil {
-// 			log.Printf("Error scanning account ID: %v", err)
-// 			continue
-// 		}
-
-// 		// Generate random sessions for the account
-// 		GenerateRandomSessions(db, accID)
-// 	}
-
-// 	// Check for errors from iterating over rows
-// 	if err := rows.Err(); err != nil {
-// 		log.Printf("Error iterating over accounts: %v", err)
-// 	}
-// }
+// List the account's active sessions, most recently used first
+func ListForAccount(db *sql.DB, accountID uint64) ([]models.Session, error) {
+	rows, err := db.Query(`
+		SELECT session_id, acc_id, COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at, last_seen_at, expiry_datetime
+		FROM sessions
+		WHERE acc_id = $1 AND expiry_datetime > NOW()
+		ORDER BY last_seen_at DESC`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var sess models.Session
+		if err := rows.Scan(&sess.SessionID, &sess.AccID, &sess.IPAddress, &sess.UserAgent, &sess.CreatedAt, &sess.LastSeenAt, &sess.ExpiryDateTime); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
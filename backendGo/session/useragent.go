@@ -0,0 +1,50 @@
+package session
+
+import "strings"
+
+// Browser tokens in the order they must be checked (Edge and Opera also advertise Chrome, Chrome also advertises Safari)
+var browserTokens = []struct {
+	Token string
+	Name  string
+}{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+// Operating system tokens in the order they must be checked (Android also advertises Linux)
+var osTokens = []struct {
+	Token string
+	Name  string
+}{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Mac OS X", "macOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// Parse a user agent string into a browser and operating system name
+func ParseUserAgent(userAgent string) (string, string) {
+	browser, os := "Unknown", "Unknown"
+
+	for _, b := range browserTokens {
+		if strings.Contains(userAgent, b.Token) {
+			browser = b.Name
+			break
+		}
+	}
+	for _, o := range osTokens {
+		if strings.Contains(userAgent, o.Token) {
+			os = o.Name
+			break
+		}
+	}
+
+	return browser, os
+}
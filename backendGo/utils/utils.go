@@ -1,13 +1,23 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 
 	"fmt"
 
 	"backendGo/config"
+
+	"github.com/lib/pq"
 )
 
 // Unified JSON response function
@@ -39,3 +49,43 @@ func ValidatePaginationParams(pageStr, limitStr string) (int, int, error) {
 
 	return page, limit, nil
 }
+
+// Resolve the client IP address, honouring X-Real-IP only when TRUST_PROXY_HEADERS is enabled;
+// the proxy sets that header from the connection, whereas X-Forwarded-For starts with whatever the client sent
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+			return realIP.String()
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Generate a random URL-safe token from 32 bytes of entropy
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash a token so that only its digest needs to be stored
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Report whether err is a Postgres unique violation, returning the name of the violated constraint or index
+func UniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
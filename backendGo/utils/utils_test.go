@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct connection", false, "203.0.113.7:51234", nil, "203.0.113.7"},
+		{"IPv6 connection", false, "[2001:db8::1]:51234", nil, "2001:db8::1"},
+		{"headers ignored without a trusted proxy", false, "203.0.113.7:51234", map[string]string{"X-Real-IP": "198.51.100.1", "X-Forwarded-For": "198.51.100.2"}, "203.0.113.7"},
+		{"real IP from the proxy", true, "127.0.0.1:40000", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"client-supplied forwarded-for ignored", true, "127.0.0.1:40000", map[string]string{"X-Real-IP": "198.51.100.1", "X-Forwarded-For": "10.9.9.9, 198.51.100.1"}, "198.51.100.1"},
+		{"forwarded-for alone ignored", true, "127.0.0.1:40000", map[string]string{"X-Forwarded-For": "10.9.9.9"}, "127.0.0.1"},
+		{"invalid real IP falls back", true, "127.0.0.1:40000", map[string]string{"X-Real-IP": "not-an-ip"}, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.trustProxy {
+				t.Setenv("TRUST_PROXY_HEADERS", "true")
+			} else {
+				t.Setenv("TRUST_PROXY_HEADERS", "")
+			}
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package validation
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize applies NFKC and trims surrounding whitespace so visually identical input is stored identically
+func Normalize(s string) string {
+	return strings.TrimSpace(norm.NFKC.String(s))
+}
+
+// Key folds an identifier for case-insensitive comparison; usernames and emails are unique on this form
+func Key(s string) string {
+	// Case folding can produce sequences that are no longer NFKC, so normalize once more
+	return norm.NFKC.String(cases.Fold().String(Normalize(s)))
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	_ "embed"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"backendGo/config"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+// Lowercased common passwords, loaded once from the bundled list
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors collects every invalid field in a request
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add a field error to the list
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Body builds the structured JSON response for a rejected request
+func (e Errors) Body() map[string]interface{} {
+	return map[string]interface{}{
+		"error":  "Validation failed",
+		"fields": e,
+	}
+}
+
+// Parse the bundled list, skipping blank lines and comments
+func loadCommonPasswords(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
+
+// Check a username's length and character set
+func Username(field, username string, errs *Errors) {
+	length := len([]rune(username))
+	if length < config.UsernameMinLength || length > config.UsernameMaxLength {
+		errs.Add(field, fmt.Sprintf("Must be between %d and %d characters", config.UsernameMinLength, config.UsernameMaxLength))
+		return
+	}
+
+	for i, c := range username {
+		isAlphanumeric := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if i == 0 && !isAlphanumeric {
+			errs.Add(field, "Must start with a letter or digit")
+			return
+		}
+		if !isAlphanumeric && c != '_' && c != '-' && c != '.' {
+			errs.Add(field, "May only contain letters, digits, '_', '-' and '.'")
+			return
+		}
+	}
+}
+
+// Check that an email is a bare address that fits in the database
+func Email(field, email string, errs *Errors) {
+	if email == "" {
+		errs.Add(field, "Is required")
+		return
+	}
+	if len(email) > config.EmailMaxLength {
+		errs.Add(field, fmt.Sprintf("Must be at most %d characters", config.EmailMaxLength))
+		return
+	}
+
+	// Reject display names and anything else the parser would rewrite
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		errs.Add(field, "Must be a valid email address")
+		return
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		errs.Add(field, "Must be a valid email address")
+	}
+}
+
+// Check a new password against the length, complexity and common-password rules
+func Password(field, password, username, email string, errs *Errors) {
+	if len(password) < config.PasswordMinLength {
+		errs.Add(field, fmt.Sprintf("Must be at least %d characters", config.PasswordMinLength))
+		return
+	}
+	if len(password) > config.PasswordMaxLength {
+		errs.Add(field, fmt.Sprintf("Must be at most %d bytes", config.PasswordMaxLength))
+		return
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < config.PasswordMinCharClasses {
+		errs.Add(field, fmt.Sprintf("Must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", config.PasswordMinCharClasses))
+		return
+	}
+
+	lowered := strings.ToLower(password)
+	if _, common := commonPasswords[lowered]; common {
+		errs.Add(field, "Is too common; choose a less predictable password")
+		return
+	}
+
+	// Passwords built from the account's own identifiers are the first thing an attacker tries
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		errs.Add(field, "Must not contain your username")
+		return
+	}
+	if localPart, _, found := strings.Cut(email, "@"); found && len(localPart) >= config.UsernameMinLength && strings.Contains(lowered, strings.ToLower(localPart)) {
+		errs.Add(field, "Must not contain your email address")
+	}
+}
+
+// Validate the fields of a registration request
+func Registration(username, email, password string) Errors {
+	var errs Errors
+	Username("Username", username, &errs)
+	Email("Email", email, &errs)
+	Password("Password", password, username, email, &errs)
+	return errs
+}
@@ -0,0 +1,206 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+
+	"backendGo/config"
+)
+
+// Run a single-field check and return the message it produced, if any
+func check(t *testing.T, validate func(*Errors)) string {
+	t.Helper()
+	var errs Errors
+	validate(&errs)
+	switch len(errs) {
+	case 0:
+		return ""
+	case 1:
+		return errs[0].Message
+	default:
+		t.Fatalf("got %d errors for one field, want at most 1: %v", len(errs), errs)
+		return ""
+	}
+}
+
+func TestUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		wantErr  string
+	}{
+		{"bob", ""},
+		{"Player_One.2-x", ""},
+		{"9lives", ""},
+		{strings.Repeat("a", 20), ""},
+		{"ab", "between 3 and 20"},
+		{strings.Repeat("a", 21), "between 3 and 20"},
+		{"", "between 3 and 20"},
+		{"_bob", "start with a letter or digit"},
+		{".bob", "start with a letter or digit"},
+		{"bob smith", "May only contain"},
+		{"bob@home", "May only contain"},
+		{"bøb", "May only contain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			got := check(t, func(errs *Errors) { Username("Username", tt.username, errs) })
+			if !matches(got, tt.wantErr) {
+				t.Errorf("Username(%q) = %q, want %q", tt.username, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		wantErr string
+	}{
+		{"player@example.com", ""},
+		{"first.last+tag@mail.example.co.uk", ""},
+		{"", "Is required"},
+		{strings.Repeat("a", 39) + "@example.com", "at most 50"},
+		{"player", "valid email"},
+		{"player@", "valid email"},
+		{"Player <player@example.com>", "valid email"},
+		{"<player@example.com>", "valid email"},
+		{"player@localhost", "valid email"},
+		{"player@.example.com", "valid email"},
+		{"player@example.com.", "valid email"},
+		{" player@example.com", "valid email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got := check(t, func(errs *Errors) { Email("Email", tt.email, errs) })
+			if !matches(got, tt.wantErr) {
+				t.Errorf("Email(%q) = %q, want %q", tt.email, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{"three classes", "Tangerine42x", ""},
+		{"symbols count as a class", "tangerine!42", ""},
+		{"non-ASCII letters", "Grüßeölbaum7", ""},
+		{"too short", "Tang42!", "at least 10"},
+		{"too long", strings.Repeat("Aa1", 43), "at most 128"},
+		{"two classes", "tangerine42", "at least 3 of"},
+		{"one class", "tangerinetree", "at least 3 of"},
+		{"common", "Password123", "too common"},
+		{"contains username", "xXbobsmithXx9", "your username"},
+		{"contains username in other case", "BOBSMITHrules9", "your username"},
+		{"contains email local part", "Player.one!2024", "your email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := check(t, func(errs *Errors) { Password("Password", tt.password, "bobsmith", "player.one@example.com", errs) })
+			if !matches(got, tt.wantErr) {
+				t.Errorf("Password(%q) = %q, want %q", tt.password, got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordsPassingOtherRulesAreRejected(t *testing.T) {
+	for _, password := range []string{"Password123!", "Summer2024!", "Welcome123!", "Iloveyou1!", "Qwerty123!", "Football2023", "Liverpool123", "Changeme1!"} {
+		t.Run(password, func(t *testing.T) {
+			got := check(t, func(errs *Errors) { Password("Password", password, "bobsmith", "player.one@example.com", errs) })
+			if !matches(got, "too common") {
+				t.Errorf("Password(%q) = %q, want it rejected as too common", password, got)
+			}
+		})
+	}
+}
+
+func TestCommonPasswordListFitsPolicy(t *testing.T) {
+	if len(commonPasswords) < 5000 {
+		t.Errorf("common password list has %d entries, want a realistic list of thousands", len(commonPasswords))
+	}
+
+	// Entries the length or character-class rules already reject could never be reached
+	for password := range commonPasswords {
+		letters, others := 0, 0
+		for _, c := range password {
+			if unicode.IsLetter(c) {
+				letters++
+			} else {
+				others++
+			}
+		}
+		if len(password) < config.PasswordMinLength || letters < 2 || others == 0 {
+			t.Errorf("common password %q can never pass the other rules", password)
+		}
+	}
+}
+
+func TestPasswordIgnoresShortEmailLocalPart(t *testing.T) {
+	// A one- or two-letter local part would match far too many passwords
+	got := check(t, func(errs *Errors) { Password("Password", "Tangerine42jo", "bobsmith", "jo@example.com", errs) })
+	if got != "" {
+		t.Errorf("Password = %q, want no error", got)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	if errs := Registration("bobsmith", "bob@example.com", "Tangerine42x"); len(errs) != 0 {
+		t.Errorf("valid registration returned %v", errs)
+	}
+
+	errs := Registration("_", "not-an-email", "short")
+	var fields []string
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+	if strings.Join(fields, ",") != "Username,Email,Password" {
+		t.Errorf("invalid registration reported fields %v, want every field in order", fields)
+	}
+
+	body := errs.Body()
+	if body["error"] != "Validation failed" {
+		t.Errorf("Body error = %v", body["error"])
+	}
+	if !strings.HasPrefix(errs.Error(), "Username: ") {
+		t.Errorf("Error() = %q, want it to name the field", errs.Error())
+	}
+}
+
+func TestNormalizeAndKey(t *testing.T) {
+	tests := []struct {
+		input     string
+		normalize string
+		key       string
+	}{
+		{"  bob  ", "bob", "bob"},
+		{"BoB", "BoB", "bob"},
+		{"ｂｏｂ", "bob", "bob"},           // Fullwidth letters
+		{"Straße", "Straße", "strasse"}, // Full case folding
+		{"cafe\u0301", "café", "café"},  // Combining accent is composed
+		{"ﬁle", "file", "file"},         // Ligature
+		{"Player@Example.COM", "Player@Example.COM", "player@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Normalize(tt.input); got != tt.normalize {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.normalize)
+			}
+			if got := Key(tt.input); got != tt.key {
+				t.Errorf("Key(%q) = %q, want %q", tt.input, got, tt.key)
+			}
+		})
+	}
+}
+
+// Report whether a message is empty when no error is wanted, or contains the wanted text
+func matches(got, want string) bool {
+	if want == "" {
+		return got == ""
+	}
+	return strings.Contains(got, want)
+}
@@ -4,6 +4,9 @@ import RegisterPage from './pages/Register.vue';
 import TwoFactorAuth from './pages/twoFactorAuth.vue';
 import verifyEmail from './pages/verifyEmail.vue';
 import playerList from './pages/playerList.vue';
+import resetPassword from './pages/resetPassword.vue';
+import magicLogin from './pages/magicLogin.vue';
+import notMe from './pages/notMe.vue';
 
 const routes = [
   { path: '/', name: 'Dashboard', component: playerList }, // Default route
@@ -11,6 +14,9 @@ const routes = [
   { path: '/login', name: 'Login', component: LoginPage },
   { path: '/2fa', name: 'TwoFactorAuth', component: TwoFactorAuth }, // Add the 2FA route
   { path: '/verify-email', name: 'verifyEmail', component: verifyEmail }, // Add the 2FA route
+  { path: '/reset-password', name: 'resetPassword', component: resetPassword },
+  { path: '/magic-login', name: 'magicLogin', component: magicLogin },
+  { path: '/not-me', name: 'notMe', component: notMe },
 ];
 
 const router = createRouter({